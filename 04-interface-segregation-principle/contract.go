@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// CheckBloggerRepository checks the behaviour every BloggerRepository must
+// have. newRepo is called for each check and must return an empty repository,
+// so a failing check does not change what the next one sees. All failures are
+// reported at once.
+func CheckBloggerRepository(newRepo func() BloggerRepository) error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// setup adds Foo and Bar to a new repository
+	setup := func() (BloggerRepository, Blogger, Blogger, error) {
+		repo := newRepo()
+		f, b := Blogger{Name: "Foo"}, Blogger{Name: "Bar"}
+		if err := repo.CreateBlogger(&f); err != nil {
+			return nil, f, b, fmt.Errorf("CreateBlogger(Foo): %w", err)
+		}
+		if err := repo.CreateBlogger(&b); err != nil {
+			return nil, f, b, fmt.Errorf("CreateBlogger(Bar): %w", err)
+		}
+		return repo, f, b, nil
+	}
+	if _, _, _, err := setup(); err != nil {
+		// every check would fail the same way
+		return err
+	}
+
+	// id assignment
+	if _, f, b, err := setup(); err == nil && (f.Id == 0 || b.Id == 0 || f.Id == b.Id) {
+		fail("CreateBlogger assigned ids %d and %d, want distinct non-zero ids", f.Id, b.Id)
+	}
+
+	// read after write
+	if repo, f, _, err := setup(); err == nil {
+		if got := repo.ReadBlogger(f.Id); got == nil {
+			fail("ReadBlogger(%d) = nil, want Foo", f.Id)
+		} else if *got != f {
+			fail("ReadBlogger(%d) = %+v, want %+v", f.Id, *got, f)
+		}
+		if got := repo.ReadBlogger(-1); got != nil {
+			fail("ReadBlogger(-1) = %+v, want nil", *got)
+		}
+	}
+
+	// returned values are copies
+	if repo, f, _, err := setup(); err == nil {
+		if got := repo.ReadBlogger(f.Id); got != nil {
+			got.Name = "Changed"
+			if again := repo.ReadBlogger(f.Id); again == nil || again.Name != "Foo" {
+				fail("changing the result of ReadBlogger(%d) changed the stored blogger", f.Id)
+			}
+		}
+	}
+
+	// duplicates
+	if repo, f, _, err := setup(); err == nil {
+		dup := Blogger{Name: "Foo"}
+		if err := repo.CreateBlogger(&dup); !errors.Is(err, ErrDuplicate) {
+			fail("CreateBlogger(Foo) twice: got %v, want ErrDuplicate", err)
+		}
+		if got := repo.ReadBlogger(f.Id); got == nil || *got != f {
+			fail("ReadBlogger(%d) changed after a rejected duplicate", f.Id)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// postFixture is what every post check starts with: Foo wrote Hello and
+// World, Bar wrote nothing yet
+type postFixture struct {
+	bloggers BloggerRepository
+	posts    PostRepository
+	foo, bar Blogger
+	p1, p2   Post
+}
+
+// CheckPostRepository checks the behaviour every PostRepository must have.
+// newRepos is called for each check and must return empty repositories that
+// share their bloggers.
+func CheckPostRepository(newRepos func() (BloggerRepository, PostRepository)) error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	setup := func() (postFixture, error) {
+		x := postFixture{foo: Blogger{Name: "Foo"}, bar: Blogger{Name: "Bar"}}
+		x.bloggers, x.posts = newRepos()
+		if err := x.bloggers.CreateBlogger(&x.foo); err != nil {
+			return x, fmt.Errorf("CreateBlogger(Foo): %w", err)
+		}
+		if err := x.bloggers.CreateBlogger(&x.bar); err != nil {
+			return x, fmt.Errorf("CreateBlogger(Bar): %w", err)
+		}
+		x.p1 = Post{Title: "Hello", Description: "First post", Tags: []string{"greeting", "intro"}, Blogger: Blogger{Id: x.foo.Id}}
+		x.p2 = Post{Title: "World", Description: "Second post", Blogger: Blogger{Id: x.foo.Id}}
+		if err := x.posts.CreatePost(&x.p1); err != nil {
+			return x, fmt.Errorf("CreatePost(Hello): %w", err)
+		}
+		if err := x.posts.CreatePost(&x.p2); err != nil {
+			return x, fmt.Errorf("CreatePost(World): %w", err)
+		}
+		return x, nil
+	}
+	if _, err := setup(); err != nil {
+		// every check would fail the same way
+		return err
+	}
+
+	// id assignment
+	if x, err := setup(); err == nil && (x.p1.Id == 0 || x.p2.Id == 0 || x.p1.Id == x.p2.Id) {
+		fail("CreatePost assigned ids %d and %d, want distinct non-zero ids", x.p1.Id, x.p2.Id)
+	}
+
+	// read after write
+	if x, err := setup(); err == nil {
+		if got := x.posts.ReadPost("Hello"); got == nil {
+			fail("ReadPost(Hello) = nil, want a post")
+		} else if got.Id != x.p1.Id || got.Description != x.p1.Description || got.Blogger != x.foo ||
+			!slices.Equal(sortedTags(got.Tags), x.p1.Tags) {
+			fail("ReadPost(Hello) = %+v, want %+v written by %+v", *got, x.p1, x.foo)
+		}
+		if got := x.posts.ReadPost("Missing"); got != nil {
+			fail("ReadPost(Missing) = %+v, want nil", *got)
+		}
+	}
+
+	// returned values are copies
+	if x, err := setup(); err == nil {
+		if got := x.posts.ReadPost("Hello"); got != nil {
+			got.Description = "Changed"
+			if len(got.Tags) > 0 {
+				got.Tags[0] = "changed"
+			}
+			if again := x.posts.ReadPost("Hello"); again == nil || again.Description != x.p1.Description ||
+				!slices.Contains(again.Tags, x.p1.Tags[0]) {
+				fail("changing the result of ReadPost(Hello) changed the stored post")
+			}
+		}
+	}
+
+	// duplicates and unknown bloggers
+	if x, err := setup(); err == nil {
+		if err := x.posts.CreatePost(&Post{Title: "Hello", Blogger: Blogger{Id: x.bar.Id}}); !errors.Is(err, ErrDuplicate) {
+			fail("CreatePost(Hello) twice: got %v, want ErrDuplicate", err)
+		}
+		if err := x.posts.CreatePost(&Post{Title: "Orphan", Blogger: Blogger{Id: -1}}); !errors.Is(err, ErrNotFound) {
+			fail("CreatePost with unknown blogger: got %v, want ErrNotFound", err)
+		}
+	}
+
+	// update semantics
+	if x, err := setup(); err == nil {
+		upd := Post{Id: x.p1.Id, Title: "Hello again", Description: "Edited", Blogger: Blogger{Id: x.bar.Id}}
+		if err := x.posts.UpdatePost(&upd); err != nil {
+			fail("UpdatePost(%d): %v", x.p1.Id, err)
+		}
+		if got := x.posts.ReadPost("Hello"); got != nil {
+			fail("ReadPost(Hello) after rename = %+v, want nil", *got)
+		}
+		if got := x.posts.ReadPost("Hello again"); got == nil {
+			fail("ReadPost(Hello again) = nil, want the updated post")
+		} else if got.Id != x.p1.Id || got.Description != "Edited" || got.Blogger != x.bar || len(got.Tags) != 0 {
+			fail("ReadPost(Hello again) = %+v, want %+v written by %+v", *got, upd, x.bar)
+		}
+	}
+
+	// rejected updates
+	if x, err := setup(); err == nil {
+		if err := x.posts.UpdatePost(&Post{Id: x.p2.Id, Title: "Hello", Blogger: Blogger{Id: x.foo.Id}}); !errors.Is(err, ErrDuplicate) {
+			fail("UpdatePost to a taken title: got %v, want ErrDuplicate", err)
+		}
+		if err := x.posts.UpdatePost(&Post{Id: -1, Title: "Ghost", Blogger: Blogger{Id: x.foo.Id}}); !errors.Is(err, ErrNotFound) {
+			fail("UpdatePost of unknown post: got %v, want ErrNotFound", err)
+		}
+		if err := x.posts.UpdatePost(&Post{Id: x.p2.Id, Title: "World", Blogger: Blogger{Id: -1}}); !errors.Is(err, ErrNotFound) {
+			fail("UpdatePost with unknown blogger: got %v, want ErrNotFound", err)
+		}
+		if got := x.posts.ReadPost("World"); got == nil || got.Blogger != x.foo || got.Description != x.p2.Description {
+			fail("ReadPost(World) changed after rejected updates")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// tags may come back in any order
+func sortedTags(tags []string) []string {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	return tags
+}
+
+// CheckConcurrentAccess creates and reads bloggers and posts from many
+// goroutines at once. Run it with the race detector enabled to prove that
+// a repository is safe for concurrent use.
+func CheckConcurrentAccess(newRepos func() (BloggerRepository, PostRepository), workers int) error {
+	bloggers, posts := newRepos()
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		ids  = map[int]bool{}
+		wg   sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			b := Blogger{Name: fmt.Sprintf("Blogger %d", w)}
+			if err := bloggers.CreateBlogger(&b); err != nil {
+				fail(fmt.Errorf("CreateBlogger(%s): %w", b.Name, err))
+				return
+			}
+			mu.Lock()
+			if ids[b.Id] {
+				errs = append(errs, fmt.Errorf("CreateBlogger handed out id %d twice", b.Id))
+			}
+			ids[b.Id] = true
+			mu.Unlock()
+
+			p := Post{Title: fmt.Sprintf("Post %d", w), Blogger: Blogger{Id: b.Id}}
+			if err := posts.CreatePost(&p); err != nil {
+				fail(fmt.Errorf("CreatePost(%s): %w", p.Title, err))
+				return
+			}
+			for i := 0; i < 10; i++ {
+				p.Description = fmt.Sprintf("revision %d", i)
+				if err := posts.UpdatePost(&p); err != nil {
+					fail(fmt.Errorf("UpdatePost(%s): %w", p.Title, err))
+				}
+				if got := posts.ReadPost(p.Title); got == nil || got.Blogger.Id != b.Id {
+					fail(fmt.Errorf("ReadPost(%s) lost its blogger", p.Title))
+				}
+				if got := bloggers.ReadBlogger(b.Id); got == nil || got.Name != b.Name {
+					fail(fmt.Errorf("ReadBlogger(%d) = %v, want %s", b.Id, got, b.Name))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -1,19 +1,41 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
 
 type Blogger struct {
-	Id   int
-	Name string
+	Id   int    `json:"id"`
+	Name string `json:"name"`
 }
 
 type Post struct {
-	Id          int
-	Title       string
-	Description string
-	Blogger     Blogger
+	Id          int      `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags,omitempty"`
+	Blogger     Blogger  `json:"blogger"`
 }
 
+// clone gives the post its own tags, so it shares nothing with the original
+func (p Post) clone() Post {
+	p.Tags = slices.Clone(p.Tags)
+	return p
+}
+
+var (
+	ErrDuplicate = errors.New("already exists")
+	ErrNotFound  = errors.New("not found")
+	ErrInvalid   = errors.New("invalid")
+)
+
 type BloggerRepository interface {
 	CreateBlogger(b *Blogger) error
 	ReadBlogger(id int) *Blogger
@@ -25,49 +47,170 @@ type PostRepository interface {
 	UpdatePost(p *Post) error
 }
 
+// PostLister pages through posts ordered by id
+type PostLister interface {
+	ListPosts(offset, limit int) []Post
+}
+
+// Cache is safe for concurrent use. It never hands out pointers into its
+// own storage, only copies.
 type Cache struct {
+	mu       sync.RWMutex
 	bloggers []Blogger
 	posts    []Post
+
+	// ids are never reused, even if an entry is removed later
+	lastBloggerId int
+	lastPostId    int
+
+	// see revision.go
+	revisions map[int][]Revision
+	trash     []DeletedPost
+	now       func() time.Time
 }
 
 func (c *Cache) CreateBlogger(b *Blogger) error {
-	b.Id = len(c.bloggers) + 1
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.bloggers {
+		if c.bloggers[i].Name == b.Name {
+			return fmt.Errorf("blogger %q: %w", b.Name, ErrDuplicate)
+		}
+	}
+
+	c.lastBloggerId++
+	b.Id = c.lastBloggerId
 	c.bloggers = append(c.bloggers, *b)
 	return nil
 }
 func (c *Cache) ReadBlogger(id int) *Blogger {
-	var result *Blogger
-	for b := range c.bloggers {
-		if c.bloggers[b].Id == id {
-			result = &c.bloggers[b]
-			break
-		}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i := c.findBlogger(id)
+	if i < 0 {
+		return nil
 	}
-	return result
+	result := c.bloggers[i]
+	return &result
 }
 func (c *Cache) CreatePost(p *Post) error {
-	// ...
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.findBlogger(p.Blogger.Id)
+	if b < 0 {
+		return fmt.Errorf("blogger %d: %w", p.Blogger.Id, ErrNotFound)
+	}
+	if c.findPost(p.Title) >= 0 {
+		return fmt.Errorf("post %q: %w", p.Title, ErrDuplicate)
+	}
+
+	c.lastPostId++
+	p.Id = c.lastPostId
+	p.Blogger = c.bloggers[b]
+	c.posts = append(c.posts, p.clone())
+	c.addRevision(*p, p.Blogger)
 	return nil
 }
 func (c *Cache) ReadPost(title string) *Post {
-	// ...
-	return nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i := c.findPost(title)
+	if i < 0 {
+		return nil
+	}
+	result := c.posts[i].clone()
+	return &result
 }
+
+// UpdatePost does not say who made the change, its revision has no author
 func (c *Cache) UpdatePost(p *Post) error {
-	// ...
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updatePost(p, Blogger{})
+}
+
+// updatePost expects the caller to hold the lock
+func (c *Cache) updatePost(p *Post, editor Blogger) error {
+	i := c.findPostById(p.Id)
+	if i < 0 {
+		return fmt.Errorf("post %d: %w", p.Id, ErrNotFound)
+	}
+
+	b := c.findBlogger(p.Blogger.Id)
+	if b < 0 {
+		return fmt.Errorf("blogger %d: %w", p.Blogger.Id, ErrNotFound)
+	}
+	if j := c.findPost(p.Title); j >= 0 && j != i {
+		return fmt.Errorf("post %q: %w", p.Title, ErrDuplicate)
+	}
+
+	p.Blogger = c.bloggers[b]
+	c.posts[i] = p.clone()
+	c.addRevision(*p, editor)
 	return nil
 }
 
-func AddBlogger(repo BloggerRepository, b *Blogger) {
-	err := repo.CreateBlogger(b)
-	if err != nil {
-		panic(err)
+func (c *Cache) ListPosts(offset, limit int) []Post {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if offset < 0 || offset >= len(c.posts) || limit <= 0 {
+		return []Post{}
+	}
+	end := min(offset+limit, len(c.posts))
+
+	// posts are appended in id order, so the slice is already sorted
+	result := make([]Post, 0, end-offset)
+	for _, p := range c.posts[offset:end] {
+		result = append(result, p.clone())
+	}
+	return result
+}
+
+// the find helpers expect the caller to hold the lock
+func (c *Cache) findBlogger(id int) int {
+	for i := range c.bloggers {
+		if c.bloggers[i].Id == id {
+			return i
+		}
 	}
+	return -1
+}
 
-	fmt.Println("New created blogger id is:", b.Id)
+func (c *Cache) findPostById(id int) int {
+	for i := range c.posts {
+		if c.posts[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Cache) findPost(title string) int {
+	for i := range c.posts {
+		if c.posts[i].Title == title {
+			return i
+		}
+	}
+	return -1
+}
+
+func AddBlogger(repo BloggerRepository, b *Blogger) error {
+	b.Name = strings.TrimSpace(b.Name)
+	if b.Name == "" {
+		return fmt.Errorf("blogger name is required: %w", ErrInvalid)
+	}
+	return repo.CreateBlogger(b)
 }
 
 func main() {
+	addr := flag.String("http", "", "serve the blog API on this address, e.g. :8080")
+	flag.Parse()
+
 	cache := Cache{}
 
 	f := Blogger{}
@@ -75,6 +218,21 @@ func main() {
 	b := Blogger{}
 	b.Name = "Bar"
 
-	AddBlogger(&cache, &f)
-	AddBlogger(&cache, &b)
+	for _, blogger := range []*Blogger{&f, &b} {
+		if err := AddBlogger(&cache, blogger); err != nil {
+			panic(err)
+		}
+		fmt.Println("New created blogger id is:", blogger.Id)
+	}
+
+	if *addr != "" {
+		index := NewIndex()
+		index.AddAll(&cache)
+		posts := NewIndexedPosts(&cache, index)
+
+		fmt.Println("Serving the blog API on", *addr)
+		if err := http.ListenAndServe(*addr, NewServer(&cache, posts, &cache, index)); err != nil {
+			panic(err)
+		}
+	}
 }
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func newCache() (BloggerRepository, PostRepository) {
+	cache := &Cache{}
+	return cache, cache
+}
+
+func TestCacheBloggerRepository(t *testing.T) {
+	if err := CheckBloggerRepository(func() BloggerRepository { return &Cache{} }); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCachePostRepository(t *testing.T) {
+	if err := CheckPostRepository(newCache); err != nil {
+		t.Error(err)
+	}
+}
+
+// run with go test -race
+func TestCacheConcurrentAccess(t *testing.T) {
+	if err := CheckConcurrentAccess(newCache, 50); err != nil {
+		t.Error(err)
+	}
+}
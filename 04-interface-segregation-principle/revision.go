@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PostVersioner is an optional capability. A PostRepository that keeps
+// every prior version of a post also implements it; callers check with a
+// type assertion instead of every repository having to support it. The
+// editor of a change, who may not be the blogger owning the post, is the
+// author of its revision.
+type PostVersioner interface {
+	Revisions(postId int) []Revision
+	UpdatePostAs(p *Post, editor Blogger) error
+	RestoreRevision(postId, number int, editor Blogger) error
+}
+
+// PostTrash is an optional capability for repositories with soft deletes.
+// A deleted post is hidden from reads until it is restored.
+type PostTrash interface {
+	DeletePost(id int) error
+	Trash() []DeletedPost
+	RestorePost(id int) error
+}
+
+type Revision struct {
+	Number    int       `json:"number"`
+	Post      Post      `json:"post"`
+	Author    Blogger   `json:"author"` // zero when not known
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeletedPost struct {
+	Post      Post      `json:"post"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type Change struct {
+	Field string   `json:"field"`
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Lines []string `json:"lines,omitempty"` // line diff of the description
+}
+
+// the revision helpers expect the caller to hold the lock
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Cache) addRevision(p Post, editor Blogger) {
+	if c.revisions == nil {
+		c.revisions = map[int][]Revision{}
+	}
+	c.revisions[p.Id] = append(c.revisions[p.Id], Revision{
+		Number:    len(c.revisions[p.Id]) + 1,
+		Post:      p.clone(),
+		Author:    editor,
+		CreatedAt: c.clock(),
+	})
+}
+
+func (c *Cache) Revisions(postId int) []Revision {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]Revision, 0, len(c.revisions[postId]))
+	for _, r := range c.revisions[postId] {
+		r.Post = r.Post.clone()
+		result = append(result, r)
+	}
+	return result
+}
+
+// UpdatePostAs is UpdatePost telling who made the change
+func (c *Cache) UpdatePostAs(p *Post, editor Blogger) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.findBlogger(editor.Id)
+	if e < 0 {
+		return fmt.Errorf("editor %d: %w", editor.Id, ErrNotFound)
+	}
+	return c.updatePost(p, c.bloggers[e])
+}
+
+// RestoreRevision saves an old version of a post as its newest revision,
+// so the history itself is never rewritten
+func (c *Cache) RestoreRevision(postId, number int, editor Blogger) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.findBlogger(editor.Id)
+	if e < 0 {
+		return fmt.Errorf("editor %d: %w", editor.Id, ErrNotFound)
+	}
+	revisions := c.revisions[postId]
+	if number < 1 || number > len(revisions) {
+		return fmt.Errorf("revision %d of post %d: %w", number, postId, ErrNotFound)
+	}
+	p := revisions[number-1].Post.clone()
+	return c.updatePost(&p, c.bloggers[e])
+}
+
+func (c *Cache) DeletePost(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i := c.findPostById(id)
+	if i < 0 {
+		return fmt.Errorf("post %d: %w", id, ErrNotFound)
+	}
+	c.trash = append(c.trash, DeletedPost{Post: c.posts[i], DeletedAt: c.clock()})
+	c.posts = slices.Delete(c.posts, i, i+1)
+	return nil
+}
+
+func (c *Cache) Trash() []DeletedPost {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]DeletedPost, 0, len(c.trash))
+	for _, d := range c.trash {
+		d.Post = d.Post.clone()
+		result = append(result, d)
+	}
+	return result
+}
+
+// RestorePost fails with ErrDuplicate when another post took the title
+// while this one was in the trash
+func (c *Cache) RestorePost(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := slices.IndexFunc(c.trash, func(d DeletedPost) bool { return d.Post.Id == id })
+	if t < 0 {
+		return fmt.Errorf("deleted post %d: %w", id, ErrNotFound)
+	}
+	p := c.trash[t].Post
+	if c.findPost(p.Title) >= 0 {
+		return fmt.Errorf("post %q: %w", p.Title, ErrDuplicate)
+	}
+
+	// keep posts sorted by id for ListPosts
+	i, _ := slices.BinarySearchFunc(c.posts, id, func(p Post, id int) int { return p.Id - id })
+	c.posts = slices.Insert(c.posts, i, p)
+	c.trash = slices.Delete(c.trash, t, t+1)
+	return nil
+}
+
+// DiffRevisions lists the fields that changed from one revision to another
+func DiffRevisions(from, to Revision) []Change {
+	var changes []Change
+	if from.Post.Title != to.Post.Title {
+		changes = append(changes, Change{Field: "title", From: from.Post.Title, To: to.Post.Title})
+	}
+	if from.Post.Description != to.Post.Description {
+		changes = append(changes, Change{
+			Field: "description",
+			From:  from.Post.Description,
+			To:    to.Post.Description,
+			Lines: diffLines(from.Post.Description, to.Post.Description),
+		})
+	}
+	if a, b := sortedTags(from.Post.Tags), sortedTags(to.Post.Tags); !slices.Equal(a, b) {
+		changes = append(changes, Change{Field: "tags", From: strings.Join(a, ","), To: strings.Join(b, ",")})
+	}
+	if from.Post.Blogger != to.Post.Blogger {
+		changes = append(changes, Change{Field: "blogger", From: from.Post.Blogger.Name, To: to.Post.Blogger.Name})
+	}
+	return changes
+}
+
+// diffLines marks removed lines with "-", added lines with "+" and kept
+// lines with " ", based on their longest common subsequence
+func diffLines(from, to string) []string {
+	a, b := strings.Split(from, "\n"), strings.Split(to, "\n")
+
+	// lcs[i][j] is the common length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+"+b[j])
+	}
+	return lines
+}
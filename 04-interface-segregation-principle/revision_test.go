@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newBlog returns a cache with the bloggers foo and bar, and a post by foo
+func newBlog(t *testing.T) (*Cache, Blogger, Blogger, Post) {
+	t.Helper()
+	c := &Cache{}
+	foo, bar := Blogger{Name: "Foo"}, Blogger{Name: "Bar"}
+	for _, b := range []*Blogger{&foo, &bar} {
+		if err := c.CreateBlogger(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := Post{Title: "Hello", Description: "one\ntwo", Tags: []string{"intro"}, Blogger: foo}
+	if err := c.CreatePost(&p); err != nil {
+		t.Fatal(err)
+	}
+	return c, foo, bar, p
+}
+
+func TestRevisions(t *testing.T) {
+	c, foo, bar, p := newBlog(t)
+
+	edited := p.clone()
+	edited.Title = "Hello again"
+	edited.Description = "one\nthree"
+	if err := c.UpdatePostAs(&edited, bar); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdatePostAs(&edited, Blogger{Id: 99}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdatePostAs by an unknown editor = %v, want %v", err, ErrNotFound)
+	}
+
+	revisions := c.Revisions(p.Id)
+	if len(revisions) != 2 {
+		t.Fatalf("%d revisions, want 2", len(revisions))
+	}
+	// the owner created the post, bar edited it
+	if revisions[0].Author != foo || revisions[1].Author != bar {
+		t.Errorf("revision authors %+v and %+v, want %+v and %+v", revisions[0].Author, revisions[1].Author, foo, bar)
+	}
+	if revisions[1].Post.Blogger != foo {
+		t.Errorf("the edit changed the owner to %+v", revisions[1].Post.Blogger)
+	}
+
+	changes := DiffRevisions(revisions[0], revisions[1])
+	fields := []string{}
+	for _, ch := range changes {
+		fields = append(fields, ch.Field)
+	}
+	if !slices.Equal(fields, []string{"title", "description"}) {
+		t.Errorf("changed fields %q, want title and description", fields)
+	}
+	if want := []string{" one", "-two", "+three"}; len(changes) == 2 && !slices.Equal(changes[1].Lines, want) {
+		t.Errorf("description diff %q, want %q", changes[1].Lines, want)
+	}
+
+	if err := c.RestoreRevision(p.Id, 1, foo); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.ReadPost("Hello"); got == nil || got.Description != "one\ntwo" {
+		t.Errorf("after restoring revision 1, ReadPost = %+v", got)
+	}
+	revisions = c.Revisions(p.Id)
+	if len(revisions) != 3 || revisions[2].Author != foo || revisions[2].Post.Title != "Hello" {
+		t.Errorf("restoring did not add a revision by foo: %+v", revisions)
+	}
+	if err := c.RestoreRevision(p.Id, 4, foo); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RestoreRevision of a missing revision = %v, want %v", err, ErrNotFound)
+	}
+
+	// UpdatePost does not say who made the change
+	if err := c.UpdatePost(&edited); err != nil {
+		t.Fatal(err)
+	}
+	if revisions := c.Revisions(p.Id); revisions[len(revisions)-1].Author != (Blogger{}) {
+		t.Errorf("UpdatePost recorded %+v as the author", revisions[len(revisions)-1].Author)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	c, foo, _, p := newBlog(t)
+
+	if err := c.DeletePost(p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if c.ReadPost("Hello") != nil {
+		t.Error("a deleted post can still be read")
+	}
+	if trash := c.Trash(); len(trash) != 1 || trash[0].Post.Id != p.Id {
+		t.Errorf("Trash = %+v, want the deleted post", trash)
+	}
+	if err := c.DeletePost(p.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeletePost twice = %v, want %v", err, ErrNotFound)
+	}
+
+	// the title was taken while the post was in the trash
+	other := Post{Title: "Hello", Blogger: foo}
+	if err := c.CreatePost(&other); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestorePost(p.Id); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("RestorePost with the title taken = %v, want %v", err, ErrDuplicate)
+	}
+	if err := c.DeletePost(other.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestorePost(p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.ReadPost("Hello"); got == nil || got.Id != p.Id {
+		t.Errorf("after RestorePost, ReadPost = %+v, want post %d", got, p.Id)
+	}
+	// posts stay in id order
+	if posts := c.ListPosts(0, 10); len(posts) != 1 || posts[0].Id != p.Id {
+		t.Errorf("ListPosts = %+v", posts)
+	}
+	if err := c.RestorePost(p.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RestorePost twice = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestIndexedPostsCapabilities(t *testing.T) {
+	c, foo, bar, p := newBlog(t)
+	index := NewIndex()
+	index.AddAll(c)
+	posts := NewIndexedPosts(c, index)
+
+	versioner, ok := posts.(PostVersioner)
+	if !ok {
+		t.Fatal("IndexedPosts hides PostVersioner")
+	}
+	trash, ok := posts.(PostTrash)
+	if !ok {
+		t.Fatal("IndexedPosts hides PostTrash")
+	}
+	found := func(text string) bool {
+		return len(index.Search(SearchQuery{Text: text})) > 0
+	}
+
+	edited := p.clone()
+	edited.Description = "edited"
+	if err := versioner.UpdatePostAs(&edited, bar); err != nil {
+		t.Fatal(err)
+	}
+	if !found("edited") || found("two") {
+		t.Error("UpdatePostAs did not update the index")
+	}
+	if err := versioner.RestoreRevision(p.Id, 1, foo); err != nil {
+		t.Fatal(err)
+	}
+	if found("edited") || !found("two") {
+		t.Error("RestoreRevision did not update the index")
+	}
+
+	if err := trash.DeletePost(p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if found("hello") {
+		t.Error("DeletePost left the post in the index")
+	}
+	if err := trash.RestorePost(p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if !found("hello") {
+		t.Error("RestorePost did not index the post again")
+	}
+
+	// a repository without the capabilities gets a decorator without them
+	plain := NewIndexedPosts(struct{ PostRepository }{c}, index)
+	if _, ok := plain.(PostVersioner); ok {
+		t.Error("IndexedPosts of a plain repository is a PostVersioner")
+	}
+	if _, ok := plain.(PostTrash); ok {
+		t.Error("IndexedPosts of a plain repository is a PostTrash")
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PostSearcher is kept apart from PostRepository: storing posts and
+// searching them are different behaviours, and most code only needs one.
+type PostSearcher interface {
+	Search(q SearchQuery) []SearchResult
+}
+
+type SearchQuery struct {
+	Text      string   // every word must appear in the title or description
+	Tags      []string // every tag must be present
+	BloggerId int      // zero matches any blogger
+	Limit     int      // zero returns every match
+}
+
+type SearchResult struct {
+	Post  Post    `json:"post"`
+	Score float64 `json:"score"`
+}
+
+// a word in a title counts more than the same word in a description
+const (
+	titleWeight       = 3
+	descriptionWeight = 1
+)
+
+// Index is an inverted index over post titles and descriptions.
+// It is safe for concurrent use.
+type Index struct {
+	mu    sync.RWMutex
+	posts map[int]Post
+	terms map[string]map[int]float64 // term -> post id -> weighted frequency
+}
+
+func NewIndex() *Index {
+	return &Index{posts: map[int]Post{}, terms: map[string]map[int]float64{}}
+}
+
+// Add indexes a post, replacing whatever was indexed for the same id
+func (ix *Index) Add(p Post) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(p.Id)
+	ix.posts[p.Id] = p.clone()
+
+	weights := map[string]float64{}
+	for _, t := range tokenize(p.Title) {
+		weights[t] += titleWeight
+	}
+	for _, t := range tokenize(p.Description) {
+		weights[t] += descriptionWeight
+	}
+	for t, w := range weights {
+		if ix.terms[t] == nil {
+			ix.terms[t] = map[int]float64{}
+		}
+		ix.terms[t][p.Id] = w
+	}
+}
+
+// AddAll indexes every post a lister knows about, e.g. when a store
+// already holds posts before the index is created
+func (ix *Index) AddAll(lister PostLister) {
+	const pageSize = 100
+	for offset := 0; ; offset += pageSize {
+		page := lister.ListPosts(offset, pageSize)
+		for _, p := range page {
+			ix.Add(p)
+		}
+		if len(page) < pageSize {
+			return
+		}
+	}
+}
+
+// Remove drops a post from the index, e.g. after it was moved to the trash
+func (ix *Index) Remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+// remove expects the caller to hold the lock
+func (ix *Index) remove(id int) {
+	old, ok := ix.posts[id]
+	if !ok {
+		return
+	}
+	for _, t := range tokenize(old.Title + " " + old.Description) {
+		delete(ix.terms[t], id)
+		if len(ix.terms[t]) == 0 {
+			delete(ix.terms, t)
+		}
+	}
+	delete(ix.posts, id)
+}
+
+// Search ranks matching posts by tf-idf, best first. Without any text
+// every post that passes the filters matches, ordered by id.
+func (ix *Index) Search(q SearchQuery) []SearchResult {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	scores := map[int]float64{}
+	words := tokenize(q.Text)
+	if len(words) == 0 {
+		for id := range ix.posts {
+			scores[id] = 0
+		}
+	}
+	for i, w := range words {
+		postings := ix.terms[w]
+		idf := math.Log(1 + float64(len(ix.posts))/float64(len(postings)+1))
+		for id := range scores {
+			if _, ok := postings[id]; !ok {
+				delete(scores, id)
+			}
+		}
+		for id, weight := range postings {
+			if _, ok := scores[id]; ok || i == 0 {
+				scores[id] += weight * idf
+			}
+		}
+	}
+
+	results := []SearchResult{}
+	for id, score := range scores {
+		p := ix.posts[id]
+		if q.BloggerId != 0 && p.Blogger.Id != q.BloggerId {
+			continue
+		}
+		if !hasTags(p, q.Tags) {
+			continue
+		}
+		results = append(results, SearchResult{Post: p.clone(), Score: score})
+	}
+
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return a.Post.Id - b.Post.Id
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+func hasTags(p Post, tags []string) bool {
+	for _, want := range tags {
+		found := slices.ContainsFunc(p.Tags, func(tag string) bool {
+			return strings.EqualFold(tag, want)
+		})
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// IndexedPosts decorates a PostRepository so that every post written
+// through it is also indexed
+type IndexedPosts struct {
+	PostRepository
+	index *Index
+}
+
+// NewIndexedPosts keeps the optional capabilities of repo: the decorator is
+// a PostVersioner or a PostTrash when repo is one, and keeps the index up
+// to date through them too
+func NewIndexedPosts(repo PostRepository, index *Index) PostRepository {
+	ip := &IndexedPosts{PostRepository: repo, index: index}
+	versioner, versioned := repo.(PostVersioner)
+	trash, trashed := repo.(PostTrash)
+	switch {
+	case versioned && trashed:
+		return &struct {
+			*IndexedPosts
+			indexedVersioner
+			indexedTrash
+		}{ip, indexedVersioner{versioner, index}, indexedTrash{trash, index}}
+	case versioned:
+		return &struct {
+			*IndexedPosts
+			indexedVersioner
+		}{ip, indexedVersioner{versioner, index}}
+	case trashed:
+		return &struct {
+			*IndexedPosts
+			indexedTrash
+		}{ip, indexedTrash{trash, index}}
+	}
+	return ip
+}
+
+func (ip *IndexedPosts) CreatePost(p *Post) error {
+	if err := ip.PostRepository.CreatePost(p); err != nil {
+		return err
+	}
+	ip.index.Add(*p)
+	return nil
+}
+
+func (ip *IndexedPosts) UpdatePost(p *Post) error {
+	if err := ip.PostRepository.UpdatePost(p); err != nil {
+		return err
+	}
+	ip.index.Add(*p)
+	return nil
+}
+
+type indexedVersioner struct {
+	versioner PostVersioner
+	index     *Index
+}
+
+func (iv indexedVersioner) Revisions(postId int) []Revision {
+	return iv.versioner.Revisions(postId)
+}
+
+func (iv indexedVersioner) UpdatePostAs(p *Post, editor Blogger) error {
+	if err := iv.versioner.UpdatePostAs(p, editor); err != nil {
+		return err
+	}
+	iv.index.Add(*p)
+	return nil
+}
+
+func (iv indexedVersioner) RestoreRevision(postId, number int, editor Blogger) error {
+	if err := iv.versioner.RestoreRevision(postId, number, editor); err != nil {
+		return err
+	}
+	// the restored version is the newest revision
+	if revisions := iv.versioner.Revisions(postId); len(revisions) > 0 {
+		iv.index.Add(revisions[len(revisions)-1].Post)
+	}
+	return nil
+}
+
+type indexedTrash struct {
+	trash PostTrash
+	index *Index
+}
+
+func (it indexedTrash) DeletePost(id int) error {
+	if err := it.trash.DeletePost(id); err != nil {
+		return err
+	}
+	it.index.Remove(id)
+	return nil
+}
+
+func (it indexedTrash) Trash() []DeletedPost {
+	return it.trash.Trash()
+}
+
+// RestorePost indexes the post as it was in the trash, RestorePost of the
+// repository does not return it
+func (it indexedTrash) RestorePost(id int) error {
+	trash := it.trash.Trash()
+	i := slices.IndexFunc(trash, func(d DeletedPost) bool { return d.Post.Id == id })
+	if err := it.trash.RestorePost(id); err != nil {
+		return err
+	}
+	if i >= 0 {
+		it.index.Add(trash[i].Post)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func newTestIndex() *Index {
+	foo, bar := Blogger{Id: 1, Name: "Foo"}, Blogger{Id: 2, Name: "Bar"}
+	index := NewIndex()
+	for _, p := range []Post{
+		{Id: 1, Title: "Go generics", Description: "Type parameters in Go.", Tags: []string{"go"}, Blogger: foo},
+		{Id: 2, Title: "Interfaces", Description: "Small interfaces in Go, go go go.", Tags: []string{"go", "design"}, Blogger: bar},
+		{Id: 3, Title: "Baking bread", Description: "Flour, water and time.", Tags: []string{"Food"}, Blogger: foo},
+		{Id: 4, Title: "Go and bread", Description: "Both need patience.", Tags: []string{"go", "food"}, Blogger: bar},
+	} {
+		index.Add(p)
+	}
+	return index
+}
+
+func ids(results []SearchResult) []int {
+	result := []int{}
+	for _, r := range results {
+		result = append(result, r.Post.Id)
+	}
+	return result
+}
+
+func TestIndexSearch(t *testing.T) {
+	index := newTestIndex()
+	for _, tc := range []struct {
+		name string
+		q    SearchQuery
+		want []int
+	}{
+		{"no query, by id", SearchQuery{}, []int{1, 2, 3, 4}},
+		{"every word must match", SearchQuery{Text: "go bread"}, []int{4}},
+		{"case and punctuation", SearchQuery{Text: "BREAD!"}, []int{3, 4}},
+		{"unknown word", SearchQuery{Text: "go rust"}, []int{}},
+		{"unknown first word", SearchQuery{Text: "rust go"}, []int{}},
+		{"tag, ignoring case", SearchQuery{Tags: []string{"FOOD"}}, []int{3, 4}},
+		{"every tag", SearchQuery{Tags: []string{"go", "design"}}, []int{2}},
+		{"blogger", SearchQuery{BloggerId: 2}, []int{2, 4}},
+		{"text and filters", SearchQuery{Text: "go", Tags: []string{"food"}, BloggerId: 2}, []int{4}},
+		{"limit", SearchQuery{Limit: 2}, []int{1, 2}},
+	} {
+		if got := ids(index.Search(tc.q)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: Search(%+v) = %v, want %v", tc.name, tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestIndexSearchRanking(t *testing.T) {
+	index := newTestIndex()
+
+	// more occurrences of a word count more
+	results := index.Search(SearchQuery{Text: "go"})
+	if got := ids(results); len(got) != 3 || got[2] != 4 {
+		t.Fatalf("Search(go) = %v, want post 4 last", got)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results are not ordered by score: %+v", results)
+		}
+	}
+
+	// a word in the title counts more than in the description, and a rare
+	// word weighs more than a common one
+	index = NewIndex()
+	index.Add(Post{Id: 1, Description: "common rare"})
+	index.Add(Post{Id: 2, Description: "common"})
+	index.Add(Post{Id: 3, Title: "title", Description: "common"})
+	index.Add(Post{Id: 4, Description: "title"})
+	if got := ids(index.Search(SearchQuery{Text: "title"})); !slices.Equal(got, []int{3, 4}) {
+		t.Errorf("Search(title) = %v, want the title match first", got)
+	}
+	rare := index.Search(SearchQuery{Text: "rare"})
+	common := index.Search(SearchQuery{Text: "common"})
+	if len(rare) != 1 || len(common) != 3 || rare[0].Score <= common[0].Score {
+		t.Errorf("Search(rare) = %+v, Search(common) = %+v, want rare to score higher", rare, common)
+	}
+}
+
+func TestIndexUpdateAndRemove(t *testing.T) {
+	index := newTestIndex()
+
+	index.Add(Post{Id: 3, Title: "Baking cakes", Blogger: Blogger{Id: 1}})
+	if got := ids(index.Search(SearchQuery{Text: "bread"})); !slices.Equal(got, []int{4}) {
+		t.Errorf("after updating post 3, Search(bread) = %v, want [4]", got)
+	}
+	if got := ids(index.Search(SearchQuery{Text: "cakes"})); !slices.Equal(got, []int{3}) {
+		t.Errorf("after updating post 3, Search(cakes) = %v, want [3]", got)
+	}
+
+	index.Remove(4)
+	index.Remove(99)
+	if got := ids(index.Search(SearchQuery{Text: "bread"})); len(got) != 0 {
+		t.Errorf("after removing post 4, Search(bread) = %v, want nothing", got)
+	}
+	if got := ids(index.Search(SearchQuery{})); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("after removing post 4, Search() = %v, want [1 2 3]", got)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxNameLength        = 100
+	maxTitleLength       = 200
+	maxDescriptionLength = 10000
+	maxBodyBytes         = 1 << 20
+
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// NewServer exposes bloggers and posts over HTTP. Every handler only gets
+// the repository behaviour it actually needs.
+func NewServer(bloggers BloggerRepository, posts PostRepository, lister PostLister, searcher PostSearcher) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /bloggers", createBloggerHandler(bloggers))
+	mux.HandleFunc("GET /bloggers/{id}", readBloggerHandler(bloggers))
+	mux.HandleFunc("GET /posts", listPostsHandler(lister))
+	mux.HandleFunc("POST /posts", createPostHandler(posts))
+	mux.HandleFunc("GET /posts/{title}", readPostHandler(posts))
+	mux.HandleFunc("PUT /posts/{title}", updatePostHandler(posts))
+	mux.HandleFunc("GET /search", searchHandler(searcher))
+	return mux
+}
+
+type bloggerRequest struct {
+	Name string `json:"name"`
+}
+
+type postRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	BloggerId   int      `json:"blogger_id"`
+}
+
+type postPage struct {
+	Posts      []Post `json:"posts"`
+	Offset     int    `json:"offset"`
+	Limit      int    `json:"limit"`
+	NextOffset *int   `json:"next_offset,omitempty"`
+}
+
+func createBloggerHandler(repo BloggerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := bloggerRequest{}
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if utf8.RuneCountInString(req.Name) > maxNameLength {
+			writeError(w, fmt.Errorf("name must be at most %d characters: %w", maxNameLength, ErrInvalid))
+			return
+		}
+
+		b := Blogger{Name: req.Name}
+		if err := AddBlogger(repo, &b); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/bloggers/%d", b.Id))
+		writeJSON(w, http.StatusCreated, b)
+	}
+}
+
+func readBloggerHandler(repo BloggerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, fmt.Errorf("blogger id must be a number: %w", ErrInvalid))
+			return
+		}
+
+		b := repo.ReadBlogger(id)
+		if b == nil {
+			writeError(w, fmt.Errorf("blogger %d: %w", id, ErrNotFound))
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+	}
+}
+
+func listPostsHandler(lister PostLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		limit, err := queryInt(r, "limit", defaultLimit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if offset < 0 || limit < 1 || limit > maxLimit {
+			writeError(w, fmt.Errorf("offset must be positive and limit between 1 and %d: %w", maxLimit, ErrInvalid))
+			return
+		}
+
+		// ask for one more post to know whether there is a next page
+		posts := lister.ListPosts(offset, limit+1)
+		page := postPage{Posts: posts, Offset: offset, Limit: limit}
+		if len(posts) > limit {
+			next := offset + limit
+			page.Posts = posts[:limit]
+			page.NextOffset = &next
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func createPostHandler(repo PostRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := postRequest{}
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		p := Post{Title: req.Title, Description: req.Description, Tags: req.Tags, Blogger: Blogger{Id: req.BloggerId}}
+		if err := repo.CreatePost(&p); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/posts/"+url.PathEscape(p.Title))
+		writeJSON(w, http.StatusCreated, p)
+	}
+}
+
+func readPostHandler(repo PostRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title := r.PathValue("title")
+		p := repo.ReadPost(title)
+		if p == nil {
+			writeError(w, fmt.Errorf("post %q: %w", title, ErrNotFound))
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+func updatePostHandler(repo PostRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title := r.PathValue("title")
+		current := repo.ReadPost(title)
+		if current == nil {
+			writeError(w, fmt.Errorf("post %q: %w", title, ErrNotFound))
+			return
+		}
+
+		req := postRequest{}
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		p := Post{Id: current.Id, Title: req.Title, Description: req.Description, Tags: req.Tags, Blogger: Blogger{Id: req.BloggerId}}
+		if err := repo.UpdatePost(&p); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+func searchHandler(searcher PostSearcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bloggerId, err := queryInt(r, "blogger", 0)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		limit, err := queryInt(r, "limit", defaultLimit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if limit < 1 || limit > maxLimit {
+			writeError(w, fmt.Errorf("limit must be between 1 and %d: %w", maxLimit, ErrInvalid))
+			return
+		}
+
+		results := searcher.Search(SearchQuery{
+			Text:      r.URL.Query().Get("q"),
+			Tags:      r.URL.Query()["tag"],
+			BloggerId: bloggerId,
+			Limit:     limit,
+		})
+		writeJSON(w, http.StatusOK, map[string][]SearchResult{"results": results})
+	}
+}
+
+func (req *postRequest) validate() error {
+	req.Title = strings.TrimSpace(req.Title)
+
+	var errs []error
+	if req.Title == "" {
+		errs = append(errs, errors.New("title is required"))
+	} else if utf8.RuneCountInString(req.Title) > maxTitleLength {
+		errs = append(errs, fmt.Errorf("title must be at most %d characters", maxTitleLength))
+	}
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		errs = append(errs, fmt.Errorf("description must be at most %d characters", maxDescriptionLength))
+	}
+	for _, tag := range req.Tags {
+		if strings.TrimSpace(tag) == "" {
+			errs = append(errs, errors.New("tags must not be empty"))
+			break
+		}
+	}
+	if req.BloggerId <= 0 {
+		errs = append(errs, errors.New("blogger_id is required"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+	}
+	return nil
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("malformed JSON body: %w: %w", ErrInvalid, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("body must contain a single JSON object: %w", ErrInvalid)
+	}
+	return nil
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", name, ErrInvalid)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrDuplicate):
+		status = http.StatusConflict
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
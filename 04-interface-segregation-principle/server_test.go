@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	cache := &Cache{}
+	index := NewIndex()
+	srv := httptest.NewServer(NewServer(cache, NewIndexedPosts(cache, index), cache, index))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do sends body as JSON and decodes the JSON response into out, when given
+func do(t *testing.T, srv *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding the response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServerBloggers(t *testing.T) {
+	srv := newTestServer(t)
+
+	created := Blogger{}
+	if status := do(t, srv, "POST", "/bloggers", `{"name": "Foo"}`, &created); status != http.StatusCreated {
+		t.Fatalf("POST /bloggers = %d, want %d", status, http.StatusCreated)
+	}
+	if created.Id == 0 || created.Name != "Foo" {
+		t.Errorf("POST /bloggers returned %+v, want Foo with an id", created)
+	}
+
+	got := Blogger{}
+	if status := do(t, srv, "GET", fmt.Sprintf("/bloggers/%d", created.Id), "", &got); status != http.StatusOK || got != created {
+		t.Errorf("GET /bloggers/%d = %d %+v, want %d %+v", created.Id, status, got, http.StatusOK, created)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/bloggers", `{"name": "Foo"}`, http.StatusConflict},
+		{"POST", "/bloggers", `{"name": "Foo"`, http.StatusBadRequest},
+		{"POST", "/bloggers", `{"name": "Baz", "age": 3}`, http.StatusBadRequest},
+		{"POST", "/bloggers", `{"name": " "}`, http.StatusBadRequest},
+		{"GET", "/bloggers/999", "", http.StatusNotFound},
+		{"GET", "/bloggers/foo", "", http.StatusBadRequest},
+	} {
+		if status := do(t, srv, tc.method, tc.path, tc.body, nil); status != tc.want {
+			t.Errorf("%s %s %s = %d, want %d", tc.method, tc.path, tc.body, status, tc.want)
+		}
+	}
+}
+
+func TestServerPosts(t *testing.T) {
+	srv := newTestServer(t)
+	foo := Blogger{}
+	do(t, srv, "POST", "/bloggers", `{"name": "Foo"}`, &foo)
+
+	created := Post{}
+	body := fmt.Sprintf(`{"title": "Hello World", "description": "First post", "tags": ["intro"], "blogger_id": %d}`, foo.Id)
+	if status := do(t, srv, "POST", "/posts", body, &created); status != http.StatusCreated {
+		t.Fatalf("POST /posts = %d, want %d", status, http.StatusCreated)
+	}
+	if created.Id == 0 || created.Title != "Hello World" {
+		t.Errorf("POST /posts returned %+v, want Hello World with an id", created)
+	}
+
+	got := Post{}
+	if status := do(t, srv, "GET", "/posts/Hello%20World", "", &got); status != http.StatusOK ||
+		got.Id != created.Id || got.Description != "First post" || got.Blogger != foo {
+		t.Errorf("GET /posts/Hello World = %d %+v, want %+v written by %+v", status, got, created, foo)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/posts", body, http.StatusConflict},
+		{"POST", "/posts", `not json`, http.StatusBadRequest},
+		{"POST", "/posts", fmt.Sprintf(`{"title": "Other", "blogger_id": %d, "author": "Foo"}`, foo.Id), http.StatusBadRequest},
+		{"POST", "/posts", `{"title": "Other", "blogger_id": 999}`, http.StatusNotFound},
+		{"POST", "/posts", `{"title": "", "blogger_id": 0}`, http.StatusBadRequest},
+		{"GET", "/posts/Missing", "", http.StatusNotFound},
+		{"PUT", "/posts/Missing", fmt.Sprintf(`{"title": "Missing", "blogger_id": %d}`, foo.Id), http.StatusNotFound},
+	} {
+		if status := do(t, srv, tc.method, tc.path, tc.body, nil); status != tc.want {
+			t.Errorf("%s %s %s = %d, want %d", tc.method, tc.path, tc.body, status, tc.want)
+		}
+	}
+}
+
+func TestServerRenamePost(t *testing.T) {
+	srv := newTestServer(t)
+	foo := Blogger{}
+	do(t, srv, "POST", "/bloggers", `{"name": "Foo"}`, &foo)
+	created := Post{}
+	do(t, srv, "POST", "/posts", fmt.Sprintf(`{"title": "Hello", "blogger_id": %d}`, foo.Id), &created)
+	do(t, srv, "POST", "/posts", fmt.Sprintf(`{"title": "Taken", "blogger_id": %d}`, foo.Id), nil)
+
+	updated := Post{}
+	body := fmt.Sprintf(`{"title": "Hello again", "description": "Edited", "blogger_id": %d}`, foo.Id)
+	if status := do(t, srv, "PUT", "/posts/Hello", body, &updated); status != http.StatusOK {
+		t.Fatalf("PUT /posts/Hello = %d, want %d", status, http.StatusOK)
+	}
+	if updated.Id != created.Id || updated.Title != "Hello again" {
+		t.Errorf("PUT /posts/Hello returned %+v, want post %d renamed to Hello again", updated, created.Id)
+	}
+	if status := do(t, srv, "GET", "/posts/Hello", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET /posts/Hello after rename = %d, want %d", status, http.StatusNotFound)
+	}
+	got := Post{}
+	if status := do(t, srv, "GET", "/posts/Hello%20again", "", &got); status != http.StatusOK || got.Description != "Edited" {
+		t.Errorf("GET /posts/Hello again = %d %+v, want the edited post", status, got)
+	}
+
+	body = fmt.Sprintf(`{"title": "Taken", "blogger_id": %d}`, foo.Id)
+	if status := do(t, srv, "PUT", "/posts/Hello%20again", body, nil); status != http.StatusConflict {
+		t.Errorf("PUT renaming to a taken title = %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestServerListPosts(t *testing.T) {
+	srv := newTestServer(t)
+	foo := Blogger{}
+	do(t, srv, "POST", "/bloggers", `{"name": "Foo"}`, &foo)
+	for i := range 5 {
+		do(t, srv, "POST", "/posts", fmt.Sprintf(`{"title": "Post %d", "blogger_id": %d}`, i, foo.Id), nil)
+	}
+
+	titles := func(page postPage) []string {
+		result := []string{}
+		for _, p := range page.Posts {
+			result = append(result, p.Title)
+		}
+		return result
+	}
+
+	// follow next_offset until the last page
+	seen := []string{}
+	path := "/posts?limit=2"
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("more than 3 pages of 2 for 5 posts, seen %q", seen)
+		}
+		page := postPage{}
+		if status := do(t, srv, "GET", path, "", &page); status != http.StatusOK {
+			t.Fatalf("GET %s = %d, want %d", path, status, http.StatusOK)
+		}
+		seen = append(seen, titles(page)...)
+		if page.NextOffset == nil {
+			break
+		}
+		if *page.NextOffset != page.Offset+2 {
+			t.Errorf("GET %s next_offset = %d, want %d", path, *page.NextOffset, page.Offset+2)
+		}
+		path = fmt.Sprintf("/posts?limit=2&offset=%d", *page.NextOffset)
+	}
+	if want := "Post 0,Post 1,Post 2,Post 3,Post 4"; strings.Join(seen, ",") != want {
+		t.Errorf("pages listed %q, want %s", seen, want)
+	}
+
+	page := postPage{}
+	do(t, srv, "GET", "/posts?offset=4&limit=1", "", &page)
+	if page.NextOffset != nil || len(page.Posts) != 1 {
+		t.Errorf("last page = %+v, want one post and no next_offset", page)
+	}
+
+	for _, path := range []string{"/posts?limit=0", "/posts?limit=101", "/posts?offset=-1", "/posts?limit=two"} {
+		if status := do(t, srv, "GET", path, "", nil); status != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestServerSearch(t *testing.T) {
+	srv := newTestServer(t)
+	foo, bar := Blogger{}, Blogger{}
+	do(t, srv, "POST", "/bloggers", `{"name": "Foo"}`, &foo)
+	do(t, srv, "POST", "/bloggers", `{"name": "Bar"}`, &bar)
+	for _, body := range []string{
+		fmt.Sprintf(`{"title": "Go generics", "description": "Type parameters", "tags": ["go"], "blogger_id": %d}`, foo.Id),
+		fmt.Sprintf(`{"title": "Go interfaces", "description": "Small is better", "tags": ["go", "design"], "blogger_id": %d}`, bar.Id),
+		fmt.Sprintf(`{"title": "Bread", "description": "Takes time, like go", "tags": ["food"], "blogger_id": %d}`, foo.Id),
+	} {
+		if status := do(t, srv, "POST", "/posts", body, nil); status != http.StatusCreated {
+			t.Fatalf("POST /posts %s = %d, want %d", body, status, http.StatusCreated)
+		}
+	}
+	// posts updated through the server are searched by their new text
+	body := fmt.Sprintf(`{"title": "Sourdough", "description": "Takes time", "tags": ["food"], "blogger_id": %d}`, foo.Id)
+	do(t, srv, "PUT", "/posts/Bread", body, nil)
+
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"/search?q=go", "Go generics,Go interfaces"},
+		{"/search?q=go+generics", "Go generics"},
+		{"/search?q=sourdough", "Sourdough"},
+		{"/search?q=bread", ""},
+		{"/search?tag=go&tag=design", "Go interfaces"},
+		{fmt.Sprintf("/search?blogger=%d", foo.Id), "Go generics,Sourdough"},
+		{"/search?limit=1", "Go generics"},
+	} {
+		got := struct {
+			Results []SearchResult `json:"results"`
+		}{}
+		if status := do(t, srv, "GET", tc.path, "", &got); status != http.StatusOK {
+			t.Errorf("GET %s = %d, want %d", tc.path, status, http.StatusOK)
+			continue
+		}
+		titles := []string{}
+		for _, r := range got.Results {
+			titles = append(titles, r.Post.Title)
+		}
+		if strings.Join(titles, ",") != tc.want {
+			t.Errorf("GET %s found %q, want %s", tc.path, titles, tc.want)
+		}
+	}
+
+	for _, path := range []string{"/search?limit=0", "/search?limit=101", "/search?blogger=foo"} {
+		if status := do(t, srv, "GET", path, "", nil); status != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQLStore keeps bloggers and posts in a SQL database (SQLite dialect).
+// The driver is registered by the caller, e.g. a pure Go SQLite driver
+// opened with foreign keys enabled in the DSN.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// every entry is applied once, in order, and recorded in schema_migrations
+var migrations = []string{
+	`CREATE TABLE bloggers (
+		id   INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE posts (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		title       TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		blogger_id  INTEGER NOT NULL REFERENCES bloggers(id)
+	)`,
+	`CREATE INDEX posts_blogger_id ON posts(blogger_id)`,
+	`CREATE TABLE post_tags (
+		post_id INTEGER NOT NULL REFERENCES posts(id),
+		tag     TEXT NOT NULL,
+		PRIMARY KEY (post_id, tag)
+	)`,
+}
+
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	s := &SQLStore{db: db}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		err := s.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction, committing only when fn succeeds
+func (s *SQLStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func exists(tx *sql.Tx, query string, args ...any) (bool, error) {
+	var n int
+	if err := tx.QueryRow(query, args...).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) CreateBlogger(b *Blogger) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		dup, err := exists(tx, `SELECT COUNT(*) FROM bloggers WHERE name = ?`, b.Name)
+		if err != nil {
+			return err
+		}
+		if dup {
+			return fmt.Errorf("blogger %q: %w", b.Name, ErrDuplicate)
+		}
+
+		res, err := tx.Exec(`INSERT INTO bloggers (name) VALUES (?)`, b.Name)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		b.Id = int(id)
+		return nil
+	})
+}
+
+func (s *SQLStore) ReadBlogger(id int) *Blogger {
+	b := Blogger{}
+	err := s.db.QueryRow(`SELECT id, name FROM bloggers WHERE id = ?`, id).Scan(&b.Id, &b.Name)
+	if err != nil {
+		return nil
+	}
+	return &b
+}
+
+func (s *SQLStore) CreatePost(p *Post) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		blogger, err := readBloggerTx(tx, p.Blogger.Id)
+		if err != nil {
+			return err
+		}
+
+		dup, err := exists(tx, `SELECT COUNT(*) FROM posts WHERE title = ?`, p.Title)
+		if err != nil {
+			return err
+		}
+		if dup {
+			return fmt.Errorf("post %q: %w", p.Title, ErrDuplicate)
+		}
+
+		res, err := tx.Exec(`INSERT INTO posts (title, description, blogger_id) VALUES (?, ?, ?)`,
+			p.Title, p.Description, blogger.Id)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		p.Id = int(id)
+		p.Blogger = blogger
+		return writeTags(tx, p)
+	})
+}
+
+func (s *SQLStore) ReadPost(title string) *Post {
+	p := Post{}
+	err := s.db.QueryRow(`
+		SELECT p.id, p.title, p.description, b.id, b.name
+		FROM posts p JOIN bloggers b ON b.id = p.blogger_id
+		WHERE p.title = ?`, title).
+		Scan(&p.Id, &p.Title, &p.Description, &p.Blogger.Id, &p.Blogger.Name)
+	if err != nil {
+		return nil
+	}
+	if p.Tags, err = readTags(s.db, p.Id); err != nil {
+		return nil
+	}
+	return &p
+}
+
+func (s *SQLStore) UpdatePost(p *Post) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		found, err := exists(tx, `SELECT COUNT(*) FROM posts WHERE id = ?`, p.Id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("post %d: %w", p.Id, ErrNotFound)
+		}
+
+		blogger, err := readBloggerTx(tx, p.Blogger.Id)
+		if err != nil {
+			return err
+		}
+
+		dup, err := exists(tx, `SELECT COUNT(*) FROM posts WHERE title = ? AND id <> ?`, p.Title, p.Id)
+		if err != nil {
+			return err
+		}
+		if dup {
+			return fmt.Errorf("post %q: %w", p.Title, ErrDuplicate)
+		}
+
+		_, err = tx.Exec(`UPDATE posts SET title = ?, description = ?, blogger_id = ? WHERE id = ?`,
+			p.Title, p.Description, blogger.Id, p.Id)
+		if err != nil {
+			return err
+		}
+		p.Blogger = blogger
+		return writeTags(tx, p)
+	})
+}
+
+// a post must belong to an existing blogger, even when the driver
+// has not enabled foreign key enforcement
+func readBloggerTx(tx *sql.Tx, id int) (Blogger, error) {
+	b := Blogger{}
+	err := tx.QueryRow(`SELECT id, name FROM bloggers WHERE id = ?`, id).Scan(&b.Id, &b.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, fmt.Errorf("blogger %d: %w", id, ErrNotFound)
+	}
+	return b, err
+}
+
+func (s *SQLStore) ListPosts(offset, limit int) []Post {
+	result := []Post{}
+	if offset < 0 || limit <= 0 {
+		return result
+	}
+
+	rows, err := s.db.Query(`
+		SELECT p.id, p.title, p.description, b.id, b.name
+		FROM posts p JOIN bloggers b ON b.id = p.blogger_id
+		ORDER BY p.id LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return result
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := Post{}
+		if err := rows.Scan(&p.Id, &p.Title, &p.Description, &p.Blogger.Id, &p.Blogger.Name); err != nil {
+			return result
+		}
+		result = append(result, p)
+	}
+	rows.Close()
+
+	// tags are read once the rows are released, a single connection
+	// pool could not serve both at the same time
+	for i := range result {
+		tags, err := readTags(s.db, result[i].Id)
+		if err != nil {
+			return []Post{}
+		}
+		result[i].Tags = tags
+	}
+	return result
+}
+
+func writeTags(tx *sql.Tx, p *Post) error {
+	if _, err := tx.Exec(`DELETE FROM post_tags WHERE post_id = ?`, p.Id); err != nil {
+		return err
+	}
+	for _, tag := range p.Tags {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO post_tags (post_id, tag) VALUES (?, ?)`, p.Id, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTags(db *sql.DB, postId int) ([]string, error) {
+	rows, err := db.Query(`SELECT tag FROM post_tags WHERE post_id = ? ORDER BY tag`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openSQLStore returns a store in a fresh in-memory database
+func openSQLStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLStoreBloggerRepository(t *testing.T) {
+	if err := CheckBloggerRepository(func() BloggerRepository { return openSQLStore(t) }); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLStorePostRepository(t *testing.T) {
+	err := CheckPostRepository(func() (BloggerRepository, PostRepository) {
+		s := openSQLStore(t)
+		return s, s
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLStoreMigrateTwice(t *testing.T) {
+	s := openSQLStore(t)
+	b := Blogger{Name: "Foo"}
+	if err := s.CreateBlogger(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := NewSQLStore(s.db)
+	if err != nil {
+		t.Fatalf("migrating again: %v", err)
+	}
+	if got := again.ReadBlogger(b.Id); got == nil || *got != b {
+		t.Errorf("ReadBlogger(%d) after migrating again = %v, want %+v", b.Id, got, b)
+	}
+	var applied int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("%d migrations recorded, want %d", applied, len(migrations))
+	}
+}
@@ -1,30 +1,123 @@
 package book
 
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
 type Book struct {
-	Title  string
-	Author string
+	Title  string `json:"title"`
+	Author string `json:"author"`
+
+	// optional metadata, see metadata.go
+	ISBN      string   `json:"isbn,omitempty"` // bare ISBN-13
+	Year      int      `json:"year,omitempty"`
+	Publisher string   `json:"publisher,omitempty"`
+	CoAuthors []string `json:"co_authors,omitempty"`
+	Genres    []string `json:"genres,omitempty"`
 }
 
 type BookStorage interface {
-	AddBook(title, author string) *Book
+	AddBook(title, author string) (*Book, error)
 	FindBook(title string) *Book
 }
 
+// BookSlice keeps books in memory, indexed by title, author and ISBN. It is
+// safe for concurrent use.
+//
+// Every book is allocated once and never moved, so AddBook and FindBook
+// return the stored book itself and a title always yields the same pointer.
+// Stored books are shared and must not be modified; a change replaces the
+// book with a new one instead, which readers holding the old pointer never
+// observe half done.
 type BookSlice struct {
-	books []Book
+	mu       sync.RWMutex
+	books    []*Book // in the order they were added
+	byTitle  map[string]*Book
+	byISBN   map[string]*Book
+	byAuthor map[string][]*Book // main author and co-authors
 }
 
-func (bs *BookSlice) AddBook(title, author string) *Book {
-	bk := Book{title, author}
-	bs.books = append(bs.books, bk)
-	return &bk
+// AddBook fails with ErrDuplicate when the title is already taken
+func (bs *BookSlice) AddBook(title, author string) (*Book, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.byTitle[title] != nil {
+		return nil, fmt.Errorf("%q: %w", title, ErrDuplicate)
+	}
+	bk := &Book{Title: title, Author: author}
+	bs.insert(bk)
+	return bk, nil
 }
 
 func (bs *BookSlice) FindBook(title string) *Book {
-	for _, v := range bs.books {
-		if v.Title == title {
-			return &v
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	return bs.byTitle[title]
+}
+
+// FindByAuthor returns the stored books of an author or co-author, in the
+// order they were added
+func (bs *BookSlice) FindByAuthor(author string) []*Book {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	return slices.Clone(bs.byAuthor[author])
+}
+
+func (bs *BookSlice) Len() int {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	return len(bs.books)
+}
+
+// insert expects the caller to hold the write lock
+func (bs *BookSlice) insert(bk *Book) {
+	if bs.byTitle == nil {
+		bs.byTitle = map[string]*Book{}
+		bs.byISBN = map[string]*Book{}
+		bs.byAuthor = map[string][]*Book{}
+	}
+	bs.books = append(bs.books, bk)
+	bs.byTitle[bk.Title] = bk
+	if bk.ISBN != "" {
+		bs.byISBN[bk.ISBN] = bk
+	}
+	// a book is listed once under an author who is also its co-author
+	authors := bk.Authors()
+	for i, author := range authors {
+		if !slices.Contains(authors[:i], author) {
+			bs.byAuthor[author] = append(bs.byAuthor[author], bk)
 		}
 	}
-	return nil
+}
+
+// remove expects the caller to hold the write lock. Unlike the lookups it
+// is linear in the number of books, to keep the insertion order.
+func (bs *BookSlice) remove(bk *Book) {
+	drop := func(books []*Book) []*Book {
+		return slices.DeleteFunc(books, func(b *Book) bool { return b == bk })
+	}
+	bs.books = drop(bs.books)
+	delete(bs.byTitle, bk.Title)
+	if bk.ISBN != "" {
+		delete(bs.byISBN, bk.ISBN)
+	}
+	for _, author := range bk.Authors() {
+		if books := drop(bs.byAuthor[author]); len(books) > 0 {
+			bs.byAuthor[author] = books
+		} else {
+			delete(bs.byAuthor, author)
+		}
+	}
+}
+
+// replace swaps old for bk in place, keeping its position
+func (bs *BookSlice) replace(old, bk *Book) {
+	i := slices.Index(bs.books, old)
+	bs.remove(old)
+	bs.insert(bk)
+	// insert appended it, move it back where old was
+	bs.books = slices.Insert(bs.books[:len(bs.books)-1], i, bk)
 }
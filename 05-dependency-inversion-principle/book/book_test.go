@@ -0,0 +1,114 @@
+package book_test
+
+import (
+	"fmt"
+	"testing"
+
+	"dip/book"
+	"dip/book/booktest"
+)
+
+func TestBookSlice(t *testing.T) {
+	if err := booktest.CheckBookStorage(func() book.BookStorage { return &book.BookSlice{} }); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBookSliceAdapter(t *testing.T) {
+	err := booktest.CheckBookStorageV2(func() book.BookStorageV2 {
+		return book.NewBookSliceAdapter(&book.BookSlice{})
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBookStorageAdapter(t *testing.T) {
+	err := booktest.CheckBookStorage(func() book.BookStorage {
+		return book.NewBookStorageAdapter(book.NewBookSliceAdapter(&book.BookSlice{}))
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBookSliceAuthorIndex(t *testing.T) {
+	bs := &book.BookSlice{}
+	a := book.NewBookSliceAdapter(bs)
+	// the author is also listed as a co-author
+	if _, err := a.AddBook(book.Book{Title: "Good Omens", Author: "Terry Pratchett", CoAuthors: []string{"Neil Gaiman", "Terry Pratchett"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, author := range []string{"Terry Pratchett", "Neil Gaiman"} {
+		if got := bs.FindByAuthor(author); len(got) != 1 {
+			t.Errorf("FindByAuthor(%s) = %d books, want 1", author, len(got))
+		}
+	}
+
+	if err := a.DeleteBook("Good Omens"); err != nil {
+		t.Fatal(err)
+	}
+	if got := bs.FindByAuthor("Terry Pratchett"); len(got) != 0 {
+		t.Errorf("FindByAuthor after DeleteBook = %d books, want none", len(got))
+	}
+}
+
+var benchmarkSizes = []int{1e3, 1e4, 1e5, 1e6}
+
+// BenchmarkFindBook looks up books spread over the whole slice, lookups
+// should take the same time whatever the number of books
+func BenchmarkFindBook(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		s := &book.BookSlice{}
+		titles := fill(s, n)
+		b.Run(fmt.Sprintf("books=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if s.FindBook(titles[i%n]) == nil {
+					b.Fatalf("FindBook(%s) = nil", titles[i%n])
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("books=%d/parallel", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if s.FindBook(titles[i%n]) == nil {
+						b.Errorf("FindBook(%s) = nil", titles[i%n])
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkFindByAuthor looks up the books of n/10 authors
+func BenchmarkFindByAuthor(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		s := &book.BookSlice{}
+		fill(s, n)
+		authors := max(n/10, 1)
+		b.Run(fmt.Sprintf("books=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if len(s.FindByAuthor(author(i%authors))) == 0 {
+					b.Fatalf("FindByAuthor(%s) found nothing", author(i%authors))
+				}
+			}
+		})
+	}
+}
+
+func fill(s book.BookStorage, n int) []string {
+	titles := make([]string, n)
+	for i := range titles {
+		titles[i] = fmt.Sprintf("Book %d", i)
+		s.AddBook(titles[i], author(i%max(n/10, 1)))
+	}
+	return titles
+}
+
+func author(i int) string {
+	return fmt.Sprintf("Author %d", i)
+}
@@ -0,0 +1,228 @@
+// Package booktest checks that a BookStorage implementation behaves like
+// every other one, whatever it stores its books in.
+package booktest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"dip/book"
+)
+
+// CheckBookStorage checks the behaviour every BookStorage must have.
+// newStorage must return an empty storage. All failures are reported at once.
+func CheckBookStorage(newStorage func() book.BookStorage) error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	s := newStorage()
+	defer closeStorage(s)
+
+	// add returns the stored book
+	got, err := s.AddBook("Harry Potter", "J.K. Rowling")
+	if err != nil || got == nil || got.Title != "Harry Potter" || got.Author != "J.K. Rowling" {
+		fail("AddBook(Harry Potter) = %v, %v, want the added book", got, err)
+	}
+	if _, err := s.AddBook("A Brief History of Time", "Stephen Hawking"); err != nil {
+		fail("AddBook(A Brief History of Time): %v", err)
+	}
+	if got, err := s.AddBook("Harry Potter", "Someone Else"); !errors.Is(err, book.ErrDuplicate) || got != nil {
+		fail("AddBook(Harry Potter) twice = %v, %v, want ErrDuplicate", got, err)
+	}
+
+	// read after write
+	got = s.FindBook("Harry Potter")
+	if got == nil || got.Author != "J.K. Rowling" {
+		fail("FindBook(Harry Potter) = %v, want the book by J.K. Rowling", got)
+	}
+	got = s.FindBook("A Brief History of Time")
+	if got == nil || got.Author != "Stephen Hawking" {
+		fail("FindBook(A Brief History of Time) = %v, want the book by Stephen Hawking", got)
+	}
+	if got := s.FindBook("Missing"); got != nil {
+		fail("FindBook(Missing) = %v, want nil", got)
+	}
+
+	// a storage either returns the stored book itself, the same one every
+	// time and not to be modified, or copies that can be changed freely
+	if got := s.FindBook("Harry Potter"); got != nil && got != s.FindBook("Harry Potter") {
+		got.Author = "Changed"
+		if again := s.FindBook("Harry Potter"); again == nil || again.Author != "J.K. Rowling" {
+			fail("changing the result of FindBook changed the stored book")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CheckBookStorageV2 checks the behaviour every BookStorageV2 must have.
+// newStorage must return an empty storage. All failures are reported at once.
+func CheckBookStorageV2(newStorage func() book.BookStorageV2) error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	s := newStorage()
+	defer closeStorage(s)
+
+	for _, b := range catalogue {
+		if got, err := s.AddBook(b); err != nil {
+			fail("AddBook(%s): %v", b.Title, err)
+		} else if !got.Equal(b) {
+			fail("AddBook(%s) = %v, want %v", b.Title, *got, b)
+		}
+	}
+
+	// errors
+	if _, err := s.AddBook(book.Book{Title: "Harry Potter", Author: "Someone Else"}); !errors.Is(err, book.ErrDuplicate) {
+		fail("AddBook(Harry Potter) twice: got %v, want ErrDuplicate", err)
+	}
+	if _, err := s.AddBook(book.Book{Title: "Copy", Author: "Someone Else", ISBN: "9780747532699"}); !errors.Is(err, book.ErrDuplicate) {
+		fail("AddBook with a taken ISBN: got %v, want ErrDuplicate", err)
+	}
+	if _, err := s.AddBook(book.Book{Title: "", Author: "Nobody", ISBN: "9780747532690"}); !errors.Is(err, book.ErrInvalid) {
+		fail("AddBook without title and with a wrong check digit: got %v, want ErrInvalid", err)
+	}
+	if err := s.UpdateBook("Harry Potter", book.Book{Title: "Harry Potter", Author: "J.K. Rowling", Year: -1}); !errors.Is(err, book.ErrInvalid) {
+		fail("UpdateBook with a negative year: got %v, want ErrInvalid", err)
+	}
+	if bk, err := s.FindBook("Missing"); !errors.Is(err, book.ErrNotFound) || bk != nil {
+		fail("FindBook(Missing) = %v, %v, want ErrNotFound", bk, err)
+	}
+	if err := s.UpdateBook("Missing", book.Book{Title: "Missing"}); !errors.Is(err, book.ErrNotFound) {
+		fail("UpdateBook(Missing): got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteBook("Missing"); !errors.Is(err, book.ErrNotFound) {
+		fail("DeleteBook(Missing): got %v, want ErrNotFound", err)
+	}
+	if _, err := s.ListBooks(-1, 10); err == nil {
+		fail("ListBooks(-1, 10) succeeded, want an error")
+	}
+
+	// read after write
+	if bk, err := s.FindBook("Harry Potter"); err != nil || bk.Author != "J.K. Rowling" {
+		fail("FindBook(Harry Potter) = %v, %v, want the book by J.K. Rowling", bk, err)
+	}
+	if bk, err := s.FindBook("Harry Potter"); err == nil {
+		bk.Author = "Changed"
+		bk.Genres[0] = "Changed"
+		if again, err := s.FindBook("Harry Potter"); err != nil || !again.Equal(catalogue[0]) {
+			fail("changing the result of FindBook changed the stored book")
+		}
+	}
+
+	// ISBNs are stored as ISBN-13 and can be looked up in either form
+	if bk, err := s.FindByISBN("0-7475-3269-9"); err != nil || bk.Title != "Harry Potter" {
+		fail("FindByISBN(0-7475-3269-9) = %v, %v, want Harry Potter", bk, err)
+	}
+	if bk, err := s.FindByISBN("978-0-553-38016-3"); err != nil || bk.ISBN != "9780553380163" {
+		fail("FindByISBN(978-0-553-38016-3) = %v, %v, want the book stored with ISBN 9780553380163", bk, err)
+	}
+	if _, err := s.FindByISBN("9780261103344"); !errors.Is(err, book.ErrNotFound) {
+		fail("FindByISBN of an unknown ISBN: got %v, want ErrNotFound", err)
+	}
+
+	// queries are ordered by title
+	expect := func(name string, got []book.Book, err error, want ...string) {
+		titles := []string{}
+		for _, b := range got {
+			titles = append(titles, b.Title)
+		}
+		if err != nil || !slices.Equal(titles, want) {
+			fail("%s = %q, %v, want %q", name, titles, err, want)
+		}
+	}
+	got, err := s.FindByAuthor("Stephen Hawking")
+	expect("FindByAuthor(Stephen Hawking)", got, err, "A Brief History of Time", "The Grand Design")
+	got, err = s.FindByAuthor("Leonard Mlodinow")
+	expect("FindByAuthor(Leonard Mlodinow)", got, err, "The Grand Design")
+	got, err = s.FindByTitlePrefix("the")
+	expect("FindByTitlePrefix(the)", got, err, "The Grand Design", "The Hobbit")
+	got, err = s.ListBooks(0, 2)
+	expect("ListBooks(0, 2)", got, err, "A Brief History of Time", "Harry Potter")
+	got, err = s.ListBooks(2, 2)
+	expect("ListBooks(2, 2)", got, err, "The Grand Design", "The Hobbit")
+	got, err = s.ListBooks(4, 2)
+	expect("ListBooks(4, 2)", got, err)
+
+	// update and delete
+	if err := s.UpdateBook("The Hobbit", book.Book{Title: "Harry Potter", Author: "J.R.R. Tolkien"}); !errors.Is(err, book.ErrDuplicate) {
+		fail("UpdateBook to a taken title: got %v, want ErrDuplicate", err)
+	}
+	if err := s.UpdateBook("The Hobbit", book.Book{Title: "The Hobbit", Author: "Tolkien"}); err != nil {
+		fail("UpdateBook(The Hobbit): %v", err)
+	}
+	if bk, err := s.FindBook("The Hobbit"); err != nil || bk.Author != "Tolkien" {
+		fail("FindBook(The Hobbit) after update = %v, %v, want the book by Tolkien", bk, err)
+	}
+	if err := s.UpdateBook("The Hobbit", book.Book{Title: "The Lord of the Rings", Author: "Tolkien"}); err != nil {
+		fail("UpdateBook renaming The Hobbit: %v", err)
+	}
+	if _, err := s.FindBook("The Hobbit"); !errors.Is(err, book.ErrNotFound) {
+		fail("FindBook(The Hobbit) after rename: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteBook("The Lord of the Rings"); err != nil {
+		fail("DeleteBook(The Lord of the Rings): %v", err)
+	}
+	got, err = s.ListBooks(0, 10)
+	expect("ListBooks(0, 10) after delete", got, err, "A Brief History of Time", "Harry Potter", "The Grand Design")
+
+	return errors.Join(errs...)
+}
+
+// stored as given, their ISBNs are already normalized
+var catalogue = []book.Book{
+	{Title: "Harry Potter", Author: "J.K. Rowling", ISBN: "9780747532699", Year: 1997, Publisher: "Bloomsbury", Genres: []string{"Fantasy"}},
+	{Title: "The Grand Design", Author: "Stephen Hawking", CoAuthors: []string{"Leonard Mlodinow"}, Year: 2010},
+	{Title: "A Brief History of Time", Author: "Stephen Hawking", ISBN: "9780553380163", Genres: []string{"Science"}},
+	{Title: "The Hobbit", Author: "J.R.R. Tolkien"},
+}
+
+// CheckPersistence checks that books survive reopening a storage. open is
+// called twice and must return storages backed by the same place; a storage
+// that implements io.Closer is closed before it is opened again.
+func CheckPersistence(open func() (book.BookStorageV2, error)) error {
+	s, err := open()
+	if err != nil {
+		return fmt.Errorf("first open: %w", err)
+	}
+	for _, b := range catalogue {
+		if _, err := s.AddBook(b); err != nil {
+			return fmt.Errorf("AddBook(%s): %w", b.Title, err)
+		}
+	}
+	if err := s.UpdateBook("The Hobbit", book.Book{Title: "The Hobbit", Author: "Tolkien"}); err != nil {
+		return fmt.Errorf("UpdateBook(The Hobbit): %w", err)
+	}
+	if err := s.DeleteBook("The Grand Design"); err != nil {
+		return fmt.Errorf("DeleteBook(The Grand Design): %w", err)
+	}
+	if err := closeStorage(s); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	s, err = open()
+	if err != nil {
+		return fmt.Errorf("second open: %w", err)
+	}
+	defer closeStorage(s)
+
+	got, err := s.ListBooks(0, 10)
+	want := []book.Book{catalogue[2], catalogue[0], {Title: "The Hobbit", Author: "Tolkien"}}
+	if err != nil || !slices.EqualFunc(got, want, book.Book.Equal) {
+		return fmt.Errorf("ListBooks after reopening = %v, %v, want %v", got, err, want)
+	}
+	return nil
+}
+
+func closeStorage(s any) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package book
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidISBN = errors.New("invalid ISBN")
+
+// NormalizeISBN accepts an ISBN-10 or ISBN-13, with or without hyphens and
+// spaces, checks its check digit and returns it as a bare ISBN-13
+func NormalizeISBN(s string) (string, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+
+	switch len(digits) {
+	case 10:
+		if !ValidISBN10(digits) {
+			return "", fmt.Errorf("%q: %w", s, ErrInvalidISBN)
+		}
+		return ISBN10To13(digits)
+	case 13:
+		if !ValidISBN13(digits) {
+			return "", fmt.Errorf("%q: %w", s, ErrInvalidISBN)
+		}
+		return digits, nil
+	}
+	return "", fmt.Errorf("%q must have 10 or 13 digits: %w", s, ErrInvalidISBN)
+}
+
+// ValidISBN10 checks a bare ISBN-10, whose last digit may be an X
+func ValidISBN10(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			d = int(s[i] - '0')
+		case s[i] == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+// ValidISBN13 checks a bare ISBN-13
+func ValidISBN13(s string) bool {
+	if len(s) != 13 || !isDigits(s) {
+		return false
+	}
+	return isbn13CheckDigit(s[:12]) == s[12]
+}
+
+func ISBN10To13(s string) (string, error) {
+	if !ValidISBN10(s) {
+		return "", fmt.Errorf("%q: %w", s, ErrInvalidISBN)
+	}
+	body := "978" + s[:9]
+	return body + string(isbn13CheckDigit(body)), nil
+}
+
+// ISBN13To10 only works for the 978 prefix, other ISBN-13s have no ISBN-10
+func ISBN13To10(s string) (string, error) {
+	if !ValidISBN13(s) {
+		return "", fmt.Errorf("%q: %w", s, ErrInvalidISBN)
+	}
+	if !strings.HasPrefix(s, "978") {
+		return "", fmt.Errorf("%q has no ISBN-10 form: %w", s, ErrInvalidISBN)
+	}
+
+	body := s[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", nil
+	}
+	return body + string(rune('0'+check)), nil
+}
+
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(first12[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
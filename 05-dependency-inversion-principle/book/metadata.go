@@ -0,0 +1,71 @@
+package book
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid book")
+
+// Authors returns the main author followed by the co-authors
+func (b Book) Authors() []string {
+	return append([]string{b.Author}, b.CoAuthors...)
+}
+
+func (b Book) HasAuthor(author string) bool {
+	return slices.Contains(b.Authors(), author)
+}
+
+func (b Book) Equal(o Book) bool {
+	return b.Title == o.Title && b.Author == o.Author && b.ISBN == o.ISBN &&
+		b.Year == o.Year && b.Publisher == o.Publisher &&
+		slices.Equal(b.CoAuthors, o.CoAuthors) && slices.Equal(b.Genres, o.Genres)
+}
+
+// Clone gives the book its own co-authors and genres
+func (b Book) Clone() Book {
+	b.CoAuthors = slices.Clone(b.CoAuthors)
+	b.Genres = slices.Clone(b.Genres)
+	return b
+}
+
+// Normalize validates the book and returns a copy with its ISBN in bare
+// ISBN-13 form. Every problem is reported, wrapped in ErrInvalid.
+func (b Book) Normalize() (Book, error) {
+	b = b.Clone()
+
+	var errs []error
+	if strings.TrimSpace(b.Title) == "" {
+		errs = append(errs, errors.New("title is required"))
+	}
+	for _, author := range b.Authors() {
+		if strings.TrimSpace(author) == "" {
+			errs = append(errs, errors.New("author names must not be empty"))
+			break
+		}
+	}
+	if b.ISBN != "" {
+		isbn, err := NormalizeISBN(b.ISBN)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		b.ISBN = isbn
+	}
+	if b.Year < 0 || b.Year > time.Now().Year()+1 {
+		errs = append(errs, fmt.Errorf("year %d is out of range", b.Year))
+	}
+	for _, genre := range b.Genres {
+		if strings.TrimSpace(genre) == "" {
+			errs = append(errs, errors.New("genres must not be empty"))
+			break
+		}
+	}
+
+	if len(errs) > 0 {
+		return b, fmt.Errorf("%q: %w: %w", b.Title, ErrInvalid, errors.Join(errs...))
+	}
+	return b, nil
+}
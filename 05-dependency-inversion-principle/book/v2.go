@@ -0,0 +1,204 @@
+package book
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNotFound  = errors.New("book not found")
+	ErrDuplicate = errors.New("book already exists")
+)
+
+// BookStorageV2 reports failures as errors instead of hiding them behind
+// nil. Books are validated and normalized before they are stored, and
+// a title or ISBN is only stored once. Lists are ordered by title.
+type BookStorageV2 interface {
+	AddBook(b Book) (*Book, error)
+	FindBook(title string) (*Book, error)
+	FindByISBN(isbn string) (*Book, error)
+	FindByAuthor(author string) ([]Book, error)
+	FindByTitlePrefix(prefix string) ([]Book, error)
+	ListBooks(offset, limit int) ([]Book, error)
+	UpdateBook(title string, b Book) error
+	DeleteBook(title string) error
+}
+
+// BookSliceAdapter lets the original BookSlice satisfy BookStorageV2. It
+// uses the indexes of the slice and hands out copies of the stored books.
+type BookSliceAdapter struct {
+	slice *BookSlice
+}
+
+func NewBookSliceAdapter(bs *BookSlice) *BookSliceAdapter {
+	return &BookSliceAdapter{slice: bs}
+}
+
+func (a *BookSliceAdapter) AddBook(b Book) (*Book, error) {
+	b, err := b.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	a.slice.mu.Lock()
+	defer a.slice.mu.Unlock()
+
+	if err := a.checkUnique(b, nil); err != nil {
+		return nil, err
+	}
+	stored := b.Clone()
+	a.slice.insert(&stored)
+	return &b, nil
+}
+
+func (a *BookSliceAdapter) FindBook(title string) (*Book, error) {
+	a.slice.mu.RLock()
+	defer a.slice.mu.RUnlock()
+
+	stored := a.slice.byTitle[title]
+	if stored == nil {
+		return nil, fmt.Errorf("%q: %w", title, ErrNotFound)
+	}
+	bk := stored.Clone()
+	return &bk, nil
+}
+
+// FindByISBN accepts an ISBN-10 or ISBN-13
+func (a *BookSliceAdapter) FindByISBN(isbn string) (*Book, error) {
+	isbn, err := NormalizeISBN(isbn)
+	if err != nil {
+		return nil, err
+	}
+
+	a.slice.mu.RLock()
+	defer a.slice.mu.RUnlock()
+
+	stored := a.slice.byISBN[isbn]
+	if stored == nil {
+		return nil, fmt.Errorf("ISBN %s: %w", isbn, ErrNotFound)
+	}
+	bk := stored.Clone()
+	return &bk, nil
+}
+
+func (a *BookSliceAdapter) FindByAuthor(author string) ([]Book, error) {
+	a.slice.mu.RLock()
+	defer a.slice.mu.RUnlock()
+	return sortedCopies(a.slice.byAuthor[author], func(Book) bool { return true }), nil
+}
+
+// FindByTitlePrefix ignores case
+func (a *BookSliceAdapter) FindByTitlePrefix(prefix string) ([]Book, error) {
+	a.slice.mu.RLock()
+	defer a.slice.mu.RUnlock()
+	return sortedCopies(a.slice.books, func(b Book) bool { return HasPrefixFold(b.Title, prefix) }), nil
+}
+
+func (a *BookSliceAdapter) ListBooks(offset, limit int) ([]Book, error) {
+	a.slice.mu.RLock()
+	defer a.slice.mu.RUnlock()
+	return Paginate(sortedCopies(a.slice.books, func(Book) bool { return true }), offset, limit)
+}
+
+// UpdateBook stores a new book in place of the old one, so readers of the
+// slice holding the old pointer keep an unchanged book
+func (a *BookSliceAdapter) UpdateBook(title string, b Book) error {
+	b, err := b.Normalize()
+
+	a.slice.mu.Lock()
+	defer a.slice.mu.Unlock()
+
+	old := a.slice.byTitle[title]
+	if old == nil {
+		return fmt.Errorf("%q: %w", title, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.checkUnique(b, old); err != nil {
+		return err
+	}
+	a.slice.replace(old, &b)
+	return nil
+}
+
+func (a *BookSliceAdapter) DeleteBook(title string) error {
+	a.slice.mu.Lock()
+	defer a.slice.mu.Unlock()
+
+	old := a.slice.byTitle[title]
+	if old == nil {
+		return fmt.Errorf("%q: %w", title, ErrNotFound)
+	}
+	a.slice.remove(old)
+	return nil
+}
+
+// checkUnique ignores self, the book being updated. It expects the caller
+// to hold the lock of the slice.
+func (a *BookSliceAdapter) checkUnique(b Book, self *Book) error {
+	if other := a.slice.byTitle[b.Title]; other != nil && other != self {
+		return fmt.Errorf("%q: %w", b.Title, ErrDuplicate)
+	}
+	if other := a.slice.byISBN[b.ISBN]; b.ISBN != "" && other != nil && other != self {
+		return fmt.Errorf("ISBN %s: %w", b.ISBN, ErrDuplicate)
+	}
+	return nil
+}
+
+// sortedCopies returns a sorted copy of the matching books
+func sortedCopies(books []*Book, match func(Book) bool) []Book {
+	result := []Book{}
+	for _, b := range books {
+		if match(*b) {
+			result = append(result, b.Clone())
+		}
+	}
+	SortByTitle(result)
+	return result
+}
+
+// BookStorageAdapter lets a BookStorageV2 be used where the original
+// BookStorage is expected. FindBook errors become nil books, as before.
+type BookStorageAdapter struct {
+	storage BookStorageV2
+}
+
+func NewBookStorageAdapter(s BookStorageV2) *BookStorageAdapter {
+	return &BookStorageAdapter{storage: s}
+}
+
+func (a *BookStorageAdapter) AddBook(title, author string) (*Book, error) {
+	return a.storage.AddBook(Book{Title: title, Author: author})
+}
+
+func (a *BookStorageAdapter) FindBook(title string) *Book {
+	bk, err := a.storage.FindBook(title)
+	if err != nil {
+		return nil
+	}
+	return bk
+}
+
+// helpers shared by the BookStorageV2 implementations
+
+func SortByTitle(books []Book) {
+	slices.SortFunc(books, func(a, b Book) int { return strings.Compare(a.Title, b.Title) })
+}
+
+func HasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// Paginate returns up to limit books starting at offset
+func Paginate(books []Book, offset, limit int) ([]Book, error) {
+	if offset < 0 || limit < 1 {
+		return nil, fmt.Errorf("invalid page offset %d, limit %d", offset, limit)
+	}
+	if offset >= len(books) {
+		return []Book{}, nil
+	}
+	return books[offset:min(offset+limit, len(books))], nil
+}
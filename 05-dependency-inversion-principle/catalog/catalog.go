@@ -0,0 +1,208 @@
+// Package catalog bulk loads books into a storage and dumps them back out,
+// as CSV, JSON lines or MARC-like tagged text.
+package catalog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"dip/book"
+)
+
+// RecordError is a record that could not be imported. The import goes on
+// with the next record.
+type RecordError struct {
+	Record int // 1-based
+	Line   int // where the record starts
+	Title  string
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	if e.Title != "" {
+		return fmt.Sprintf("record %d (line %d) %q: %v", e.Record, e.Line, e.Title, e.Err)
+	}
+	return fmt.Sprintf("record %d (line %d): %v", e.Record, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+type Options struct {
+	Format Format // detected when Auto
+	// DryRun validates the records and checks them for duplicates, both
+	// within the input and against the storage, without adding anything
+	DryRun bool
+	// Progress is called every ProgressEvery records and once at the end
+	Progress      func(Progress)
+	ProgressEvery int // 1000 when zero
+}
+
+type Progress struct {
+	Read   int
+	Added  int // or would have been, on a dry run
+	Failed int
+}
+
+type Report struct {
+	Format Format
+	Progress
+	Errors []*RecordError
+}
+
+// decoder reads one record at a time. A record that cannot be decoded is
+// returned as a *RecordError and decoding goes on, any other error stops it.
+type decoder interface {
+	Next() (b book.Book, line int, err error)
+}
+
+type encoder interface {
+	Write(b book.Book) error
+	Flush() error
+}
+
+// Import adds every record of r to storage. Records that are invalid or
+// already stored are listed in the report, the returned error is only set
+// when the input cannot be read any further; the report is returned anyway.
+func Import(r io.Reader, storage book.BookStorageV2, opts Options) (*Report, error) {
+	if opts.ProgressEvery <= 0 {
+		opts.ProgressEvery = 1000
+	}
+	report := &Report{Format: opts.Format}
+	progress := func() {
+		if opts.Progress != nil {
+			opts.Progress(report.Progress)
+		}
+	}
+
+	br := bufio.NewReader(r)
+	if report.Format == Auto {
+		f, err := Detect(br)
+		if err != nil {
+			return report, err
+		}
+		report.Format = f
+	}
+	dec, err := newDecoder(br, report.Format)
+	if err != nil {
+		return report, err
+	}
+
+	add := storage.AddBook
+	if opts.DryRun {
+		add = dryRun(storage)
+	}
+	for {
+		b, line, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		report.Read++
+
+		var recErr *RecordError
+		switch {
+		case errors.As(err, &recErr):
+			// the decoder skipped the record
+		case err != nil:
+			progress()
+			return report, err
+		default:
+			if _, err := add(b); err != nil {
+				recErr = &RecordError{Line: line, Title: b.Title, Err: err}
+			}
+		}
+
+		if recErr != nil {
+			recErr.Record = report.Read
+			report.Errors = append(report.Errors, recErr)
+			report.Failed++
+		} else {
+			report.Added++
+		}
+		if report.Read%opts.ProgressEvery == 0 {
+			progress()
+		}
+	}
+	progress()
+	return report, nil
+}
+
+func newDecoder(r io.Reader, f Format) (decoder, error) {
+	switch f {
+	case CSV:
+		return newCSVDecoder(r)
+	case JSONLines:
+		return newJSONLDecoder(r), nil
+	case MARC:
+		return newMARCDecoder(r), nil
+	}
+	return nil, fmt.Errorf("cannot import %s", f)
+}
+
+// dryRun checks what AddBook would, remembering the books it let through
+func dryRun(storage book.BookStorageV2) func(book.Book) (*book.Book, error) {
+	titles := map[string]bool{}
+	isbns := map[string]bool{}
+	return func(b book.Book) (*book.Book, error) {
+		b, err := b.Normalize()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := storage.FindBook(b.Title); err == nil || titles[b.Title] {
+			return nil, fmt.Errorf("%q: %w", b.Title, book.ErrDuplicate)
+		} else if !errors.Is(err, book.ErrNotFound) {
+			return nil, err
+		}
+		if b.ISBN != "" {
+			if _, err := storage.FindByISBN(b.ISBN); err == nil || isbns[b.ISBN] {
+				return nil, fmt.Errorf("ISBN %s: %w", b.ISBN, book.ErrDuplicate)
+			} else if !errors.Is(err, book.ErrNotFound) {
+				return nil, err
+			}
+			isbns[b.ISBN] = true
+		}
+		titles[b.Title] = true
+		return &b, nil
+	}
+}
+
+// exportPage is how many books Export reads at a time
+const exportPage = 500
+
+// Export writes every book of storage to w, ordered by title, and returns
+// how many it wrote. What it writes can be imported again.
+func Export(w io.Writer, storage book.BookStorageV2, f Format) (int, error) {
+	var enc encoder
+	switch f {
+	case CSV:
+		enc = newCSVEncoder(w)
+	case JSONLines:
+		enc = newJSONLEncoder(w)
+	case MARC:
+		enc = newMARCEncoder(w)
+	default:
+		return 0, fmt.Errorf("cannot export %s", f)
+	}
+
+	n := 0
+	for {
+		books, err := storage.ListBooks(n, exportPage)
+		if err != nil {
+			return n, err
+		}
+		for _, b := range books {
+			if err := enc.Write(b); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(books) < exportPage {
+			break
+		}
+	}
+	return n, enc.Flush()
+}
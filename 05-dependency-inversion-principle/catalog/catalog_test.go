@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"bytes"
+	"testing"
+
+	"dip/book"
+)
+
+// awkward books hold every character the formats use as separators
+var awkward = []book.Book{
+	{Title: "Harry Potter", Author: "J.K. Rowling", ISBN: "9780747532699", Year: 1997, Publisher: "Bloomsbury", Genres: []string{"Fantasy"}},
+	{
+		Title:     "Costs $5; or\nless",
+		Author:    `Back\slash`,
+		Year:      2001,
+		Publisher: "Dollar $b Books $c 1999",
+		CoAuthors: []string{"Smith; John", `Doe\; Jane`, "A $c B"},
+		Genres:    []string{"Sci-Fi; Fantasy", "Line\r\nbreaks", `\n`},
+	},
+	{Title: "Only an author", Author: "Someone"},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range []Format{CSV, JSONLines, MARC} {
+		t.Run(f.String(), func(t *testing.T) {
+			src := book.NewBookSliceAdapter(&book.BookSlice{})
+			for _, b := range awkward {
+				if _, err := src.AddBook(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var buf bytes.Buffer
+			n, err := Export(&buf, src, f)
+			if err != nil || n != len(awkward) {
+				t.Fatalf("Export = %d, %v, want %d books", n, err, len(awkward))
+			}
+
+			dst := book.NewBookSliceAdapter(&book.BookSlice{})
+			report, err := Import(bytes.NewReader(buf.Bytes()), dst, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Format != f || report.Added != len(awkward) || len(report.Errors) > 0 {
+				t.Fatalf("Import report %+v, want %d books added as %s\n%s", report, len(awkward), f, buf.Bytes())
+			}
+			for _, want := range awkward {
+				got, err := dst.FindBook(want.Title)
+				if err != nil {
+					t.Errorf("%q: %v\n%s", want.Title, err, buf.Bytes())
+					continue
+				}
+				if normalized, _ := want.Normalize(); !got.Equal(normalized) {
+					t.Errorf("imported %#v\nwant %#v\n%s", *got, normalized, buf.Bytes())
+				}
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, s := range []string{"", "plain", `a\b`, "a;b", "a$b", "a\nb\r", `\`, `\;\$`} {
+		escaped := escape(s, ";$")
+		if bytes.ContainsAny([]byte(escaped), "\r\n") {
+			t.Errorf("escape(%q) = %q has a line break", s, escaped)
+		}
+		if parts := splitEscaped(escaped, ';'); len(parts) != 1 {
+			t.Errorf("escape(%q) = %q splits into %q", s, escaped, parts)
+		}
+		if got := unescape(escaped); got != s {
+			t.Errorf("unescape(escape(%q)) = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dip/book"
+)
+
+// columns a CSV catalogue may have, in the order they are exported. Only
+// title is required, co-authors and genres are separated by semicolons. A
+// semicolon or a backslash within a name is escaped with a backslash.
+var columns = []string{"title", "author", "isbn", "year", "publisher", "co_authors", "genres"}
+
+type csvDecoder struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the CSV header: %w", err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(columns, header[i]) {
+			return nil, fmt.Errorf("unknown CSV column %q, want some of %s", name, strings.Join(columns, ", "))
+		}
+		if slices.Index(header, header[i]) < i {
+			return nil, fmt.Errorf("CSV column %q appears twice", name)
+		}
+	}
+	if !slices.Contains(header, "title") {
+		return nil, errors.New("the CSV header has no title column")
+	}
+	return &csvDecoder{r: cr, header: header}, nil
+}
+
+func (d *csvDecoder) Next() (book.Book, int, error) {
+	b := book.Book{}
+	record, err := d.r.Read()
+	if err == io.EOF {
+		return b, 0, err
+	}
+	if perr := (*csv.ParseError)(nil); errors.As(err, &perr) {
+		// the reader skips past a malformed record
+		return b, perr.StartLine, &RecordError{Line: perr.StartLine, Err: perr.Err}
+	} else if err != nil {
+		return b, 0, err
+	}
+	line, _ := d.r.FieldPos(0)
+
+	var errs []error
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch d.header[i] {
+		case "title":
+			b.Title = value
+		case "author":
+			b.Author = value
+		case "isbn":
+			b.ISBN = value
+		case "year":
+			if value != "" {
+				if b.Year, err = strconv.Atoi(value); err != nil {
+					errs = append(errs, fmt.Errorf("year %q is not a number", value))
+				}
+			}
+		case "publisher":
+			b.Publisher = value
+		case "co_authors":
+			b.CoAuthors = splitList(value)
+		case "genres":
+			b.Genres = splitList(value)
+		}
+	}
+	if len(errs) > 0 {
+		return b, line, &RecordError{Line: line, Title: b.Title, Err: errors.Join(errs...)}
+	}
+	return b, line, nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	items := splitEscaped(value, ';')
+	for i := range items {
+		items[i] = unescape(strings.TrimSpace(items[i]))
+	}
+	return items
+}
+
+func joinList(items []string) string {
+	escaped := make([]string, len(items))
+	for i, item := range items {
+		escaped[i] = escape(item, ";")
+	}
+	return strings.Join(escaped, ";")
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+// newCSVEncoder writes the header right away, an empty catalogue still has one
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	return &csvEncoder{w: cw}
+}
+
+func (e *csvEncoder) Write(b book.Book) error {
+	year := ""
+	if b.Year != 0 {
+		year = strconv.Itoa(b.Year)
+	}
+	return e.w.Write([]string{
+		b.Title, b.Author, b.ISBN, year, b.Publisher,
+		joinList(b.CoAuthors), joinList(b.Genres),
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
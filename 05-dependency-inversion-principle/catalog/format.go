@@ -0,0 +1,133 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Format is one of the supported catalogue formats
+type Format int
+
+const (
+	// Auto detects the format from the first record when importing
+	Auto Format = iota
+	// CSV has a header row naming the columns, see columns
+	CSV
+	// JSONLines has one JSON encoded book.Book per line
+	JSONLines
+	// MARC is a MARC-like tagged text format, see marc.go
+	MARC
+)
+
+var formatNames = map[Format]string{Auto: "auto", CSV: "csv", JSONLines: "jsonl", MARC: "marc"}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+func ParseFormat(s string) (Format, error) {
+	for f, name := range formatNames {
+		if name == s {
+			return f, nil
+		}
+	}
+	return Auto, fmt.Errorf("unknown format %q, want auto, csv, jsonl or marc", s)
+}
+
+// Detect looks at the first line that is not blank without consuming it:
+// JSON lines start with an object, MARC records with a three digit tag,
+// anything else is taken for a CSV header.
+func Detect(r *bufio.Reader) (Format, error) {
+	// Peek returns whatever is there when the input is shorter than the buffer
+	data, err := r.Peek(r.Size())
+	line := bytes.TrimLeftFunc(data, unicode.IsSpace)
+	if len(line) == 0 {
+		if err != nil && err != io.EOF {
+			return Auto, err
+		}
+		return Auto, fmt.Errorf("cannot detect the format of an empty catalogue")
+	}
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	return detectLine(line), nil
+}
+
+func detectLine(line []byte) Format {
+	if len(line) > 0 && line[0] == '{' {
+		return JSONLines
+	}
+	if _, _, ok := parseTag(string(line)); ok {
+		return MARC
+	}
+	return CSV
+}
+
+// escape puts a backslash before backslashes and the special characters
+// of a value, and writes line breaks as \n and \r, so the value fits on
+// one line and can be split on the special characters
+func escape(s, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\\' || strings.ContainsRune(special, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// unescape reverses escape
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitEscaped splits s on the separators that are not escaped, the parts
+// are still escaped
+func splitEscaped(s string, sep byte) []string {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"dip/book"
+)
+
+type jsonlDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONLDecoder(r io.Reader) *jsonlDecoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	return &jsonlDecoder{s: s}
+}
+
+func (d *jsonlDecoder) Next() (book.Book, int, error) {
+	b := book.Book{}
+	for d.s.Scan() {
+		d.line++
+		data := bytes.TrimSpace(d.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&b); err != nil {
+			return b, d.line, &RecordError{Line: d.line, Title: b.Title, Err: err}
+		}
+		return b, d.line, nil
+	}
+	if err := d.s.Err(); err != nil {
+		return b, d.line, err
+	}
+	return b, d.line, io.EOF
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLEncoder(w io.Writer) *jsonlEncoder {
+	bw := bufio.NewWriter(w)
+	return &jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (e *jsonlEncoder) Write(b book.Book) error {
+	return e.enc.Encode(b)
+}
+
+func (e *jsonlEncoder) Flush() error {
+	return e.w.Flush()
+}
@@ -0,0 +1,170 @@
+package catalog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"dip/book"
+)
+
+// The MARC-like format keeps one field per line, a three digit tag followed
+// by its value, and separates records with a blank line:
+//
+//	020 9780747532699
+//	100 J.K. Rowling
+//	245 Harry Potter
+//	260 $b Bloomsbury $c 1997
+//	650 Fantasy
+//
+// Like in MARC 21, 020 is the ISBN, 100 the main author, 245 the title,
+// 260 the publisher ($b) and year ($c), 650 a genre and 700 a co-author.
+// 650 and 700 may be repeated, other tags are ignored. In values, a
+// backslash escapes a backslash or a $, and \n and \r are line breaks.
+const (
+	tagISBN     = "020"
+	tagAuthor   = "100"
+	tagTitle    = "245"
+	tagImprint  = "260"
+	tagGenre    = "650"
+	tagCoAuthor = "700"
+)
+
+// parseTag splits a field line into its tag and value
+func parseTag(line string) (tag, value string, ok bool) {
+	if len(line) < 4 || line[3] != ' ' {
+		return "", "", false
+	}
+	for _, c := range line[:3] {
+		if c < '0' || c > '9' {
+			return "", "", false
+		}
+	}
+	return line[:3], strings.TrimSpace(line[4:]), true
+}
+
+// subfields parses "$b Bloomsbury $c 1997" by code
+func subfields(value string) map[byte]string {
+	result := map[byte]string{}
+	for _, field := range splitEscaped(value, '$')[1:] {
+		if field != "" {
+			result[field[0]] = unescape(strings.TrimSpace(field[1:]))
+		}
+	}
+	return result
+}
+
+type marcDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newMARCDecoder(r io.Reader) *marcDecoder {
+	return &marcDecoder{s: bufio.NewScanner(r)}
+}
+
+func (d *marcDecoder) Next() (book.Book, int, error) {
+	b := book.Book{}
+	start := 0
+	var errs []error
+	for d.s.Scan() {
+		d.line++
+		line := strings.TrimRight(d.s.Text(), " \t\r")
+		if line == "" {
+			if start == 0 {
+				continue
+			}
+			break
+		}
+		if start == 0 {
+			start = d.line
+		}
+
+		tag, value, ok := parseTag(line)
+		if !ok {
+			errs = append(errs, fmt.Errorf("line %d: %q is not a tagged field", d.line, line))
+			continue
+		}
+		if tag != tagImprint {
+			value = unescape(value)
+		}
+		switch tag {
+		case tagISBN:
+			b.ISBN = value
+		case tagAuthor:
+			b.Author = value
+		case tagTitle:
+			b.Title = value
+		case tagImprint:
+			sub := subfields(value)
+			b.Publisher = sub['b']
+			if year := sub['c']; year != "" {
+				var err error
+				if b.Year, err = strconv.Atoi(year); err != nil {
+					errs = append(errs, fmt.Errorf("line %d: year %q is not a number", d.line, year))
+				}
+			}
+		case tagGenre:
+			b.Genres = append(b.Genres, value)
+		case tagCoAuthor:
+			b.CoAuthors = append(b.CoAuthors, value)
+		}
+	}
+	if err := d.s.Err(); err != nil {
+		return b, d.line, err
+	}
+	if start == 0 {
+		return b, d.line, io.EOF
+	}
+	if len(errs) > 0 {
+		return b, start, &RecordError{Line: start, Title: b.Title, Err: errors.Join(errs...)}
+	}
+	return b, start, nil
+}
+
+type marcEncoder struct {
+	w     *bufio.Writer
+	first bool
+}
+
+func newMARCEncoder(w io.Writer) *marcEncoder {
+	return &marcEncoder{w: bufio.NewWriter(w), first: true}
+}
+
+func (e *marcEncoder) Write(b book.Book) error {
+	if !e.first {
+		e.w.WriteString("\n")
+	}
+	e.first = false
+
+	field := func(tag, value string) {
+		if value != "" {
+			fmt.Fprintf(e.w, "%s %s\n", tag, value)
+		}
+	}
+	field(tagISBN, escape(b.ISBN, "$"))
+	field(tagAuthor, escape(b.Author, "$"))
+	field(tagTitle, escape(b.Title, "$"))
+	imprint := ""
+	if b.Publisher != "" {
+		imprint = "$b " + escape(b.Publisher, "$")
+	}
+	if b.Year != 0 {
+		imprint = strings.TrimSpace(fmt.Sprintf("%s $c %d", imprint, b.Year))
+	}
+	field(tagImprint, imprint)
+	for _, genre := range b.Genres {
+		field(tagGenre, escape(genre, "$"))
+	}
+	for _, author := range b.CoAuthors {
+		field(tagCoAuthor, escape(author, "$"))
+	}
+	return nil
+}
+
+func (e *marcEncoder) Flush() error {
+	return e.w.Flush()
+}
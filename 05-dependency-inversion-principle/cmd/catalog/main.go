@@ -0,0 +1,138 @@
+// Command catalog imports books into a storage file and exports them again.
+//
+//	catalog [flags] import FILE
+//	catalog [flags] export [FILE]
+//
+// FILE defaults to standard output on export, "-" is standard input or output.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"dip/book"
+	"dip/catalog"
+	"dip/jsonstore"
+	"dip/kvstore"
+)
+
+func main() {
+	storage := flag.String("storage", "kv", "storage to use: json or kv")
+	path := flag.String("path", "books.db", "file used by the storage")
+	format := flag.String("format", "auto", "catalogue format: auto, csv, jsonl or marc")
+	dryRun := flag.Bool("dry-run", false, "only validate an import, do not add anything")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: catalog [flags] import FILE | export [FILE]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*storage, *path, *format, *dryRun, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "catalog:", err)
+		os.Exit(1)
+	}
+}
+
+func run(storage, path, format string, dryRun bool, args []string) error {
+	f, err := catalog.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 || len(args) > 2 || args[0] == "import" && len(args) != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store, err := open(storage, path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	file := "-"
+	if len(args) == 2 {
+		file = args[1]
+	}
+	switch args[0] {
+	case "import":
+		return importFile(store, file, catalog.Options{Format: f, DryRun: dryRun})
+	case "export":
+		if f == catalog.Auto {
+			f = catalog.CSV
+		}
+		return exportFile(store, file, f)
+	}
+	return fmt.Errorf("unknown command %q, want import or export", args[0])
+}
+
+type closingStorage interface {
+	book.BookStorageV2
+	io.Closer
+}
+
+type nopCloser struct {
+	book.BookStorageV2
+}
+
+func (nopCloser) Close() error { return nil }
+
+func open(storage, path string) (closingStorage, error) {
+	switch storage {
+	case "json":
+		s, err := jsonstore.Open(path)
+		return nopCloser{s}, err
+	case "kv":
+		return kvstore.Open(path)
+	}
+	return nil, fmt.Errorf("unknown storage %q, want json or kv", storage)
+}
+
+func importFile(store book.BookStorageV2, file string, opts catalog.Options) error {
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	opts.Progress = func(p catalog.Progress) {
+		fmt.Fprintf(os.Stderr, "\r%d read, %d added, %d failed", p.Read, p.Added, p.Failed)
+	}
+	report, err := catalog.Import(in, store, opts)
+	fmt.Fprintln(os.Stderr)
+	for _, recErr := range report.Errors {
+		fmt.Fprintln(os.Stderr, recErr)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Fprintf(os.Stderr, "dry run of %s: %d of %d records would be added\n", report.Format, report.Added, report.Read)
+	}
+	return nil
+}
+
+func exportFile(store book.BookStorageV2, file string, f catalog.Format) error {
+	if file == "-" {
+		_, err := catalog.Export(os.Stdout, store, f)
+		return err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	n, err := catalog.Export(out, store, f)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d books\n", n)
+	return nil
+}
@@ -0,0 +1,240 @@
+package di
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotRegistered = errors.New("no provider registered")
+	ErrDuplicate     = errors.New("provider already registered")
+	ErrCycle         = errors.New("dependency cycle")
+	ErrProvider      = errors.New("invalid provider")
+)
+
+type Lifetime int
+
+const (
+	// Singleton builds the value once and shares it
+	Singleton Lifetime = iota
+	// Transient builds a new value for every resolution
+	Transient
+)
+
+func (l Lifetime) String() string {
+	if l == Transient {
+		return "transient"
+	}
+	return "singleton"
+}
+
+// Container builds values from registered providers. A provider is any
+// function whose parameters are other registered types and which returns
+// the value, optionally followed by an error. It is safe for concurrent use,
+// and constructors run without holding its lock, so they may resolve other
+// types from it themselves.
+type Container struct {
+	mu        sync.Mutex
+	providers map[reflect.Type]*provider
+}
+
+type provider struct {
+	key      reflect.Type
+	lifetime Lifetime
+	fn       reflect.Value
+	deps     []reflect.Type
+
+	// held while a singleton is built, so it is built only once
+	mu       sync.Mutex
+	built    bool
+	instance reflect.Value
+}
+
+var errorType = reflect.TypeFor[error]()
+
+func New() *Container {
+	return &Container{providers: map[reflect.Type]*provider{}}
+}
+
+// Provide registers constructor as the way to build T, usually an
+// interface type. The constructor's result must be assignable to T.
+func Provide[T any](c *Container, lifetime Lifetime, constructor any) error {
+	key := reflect.TypeFor[T]()
+	fn := reflect.ValueOf(constructor)
+	if fn.Kind() != reflect.Func {
+		return fmt.Errorf("%s: %w: got %T, want a function", key, ErrProvider, constructor)
+	}
+
+	t := fn.Type()
+	switch {
+	case t.IsVariadic():
+		return fmt.Errorf("%s: %w: variadic functions are not supported", key, ErrProvider)
+	case t.NumOut() == 0 || t.NumOut() > 2:
+		return fmt.Errorf("%s: %w: %s must return the value and optionally an error", key, ErrProvider, t)
+	case !t.Out(0).AssignableTo(key):
+		return fmt.Errorf("%s: %w: %s is not assignable to it", key, ErrProvider, t.Out(0))
+	case t.NumOut() == 2 && t.Out(1) != errorType:
+		return fmt.Errorf("%s: %w: the second result of %s must be an error", key, ErrProvider, t)
+	}
+
+	deps := make([]reflect.Type, t.NumIn())
+	for i := range deps {
+		deps[i] = t.In(i)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.providers[key]; ok {
+		return fmt.Errorf("%s: %w", key, ErrDuplicate)
+	}
+	c.providers[key] = &provider{key: key, lifetime: lifetime, fn: fn, deps: deps}
+	return nil
+}
+
+// Resolve builds T together with everything it depends on
+func Resolve[T any](c *Container) (T, error) {
+	var zero T
+	key := reflect.TypeFor[T]()
+
+	v, err := c.resolve(key, nil)
+	if err != nil {
+		return zero, err
+	}
+	t, ok := v.Interface().(T)
+	if !ok {
+		return zero, fmt.Errorf("%s: %w: returned %v", key, ErrProvider, v.Interface())
+	}
+	return t, nil
+}
+
+// MustResolve is like Resolve but panics, for use after Validate succeeded
+func MustResolve[T any](c *Container) T {
+	v, err := Resolve[T](c)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// resolve takes the lock of a singleton while building it, following the
+// dependencies, so locks are always taken in the same order. path is the
+// chain of types being built and is used to detect cycles before taking
+// any lock twice.
+func (c *Container) resolve(key reflect.Type, path []reflect.Type) (reflect.Value, error) {
+	if slices.Contains(path, key) {
+		return reflect.Value{}, fmt.Errorf("%w: %s", ErrCycle, formatPath(append(path, key)))
+	}
+	c.mu.Lock()
+	p, ok := c.providers[key]
+	c.mu.Unlock()
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%s: %w", formatPath(append(path, key)), ErrNotRegistered)
+	}
+	if p.lifetime == Singleton {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.built {
+			return p.instance, nil
+		}
+	}
+
+	path = append(path, key)
+	args := make([]reflect.Value, len(p.deps))
+	for i, dep := range p.deps {
+		v, err := c.resolve(dep, path)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		args[i] = v
+	}
+
+	out := p.fn.Call(args)
+	if len(out) == 2 && !out[1].IsNil() {
+		return reflect.Value{}, fmt.Errorf("building %s: %w", key, out[1].Interface().(error))
+	}
+
+	// keep the value typed as the registered key
+	v := reflect.New(key).Elem()
+	v.Set(out[0])
+	if isNil(v) {
+		return reflect.Value{}, fmt.Errorf("%s: %w: returned nil", key, ErrProvider)
+	}
+	if p.lifetime == Singleton {
+		p.instance, p.built = v, true
+	}
+	return v, nil
+}
+
+// Validate checks the whole graph without building anything: every
+// dependency must be registered, there must be no cycles, and a singleton
+// must not capture a transient. Every problem is reported.
+func (c *Container) Validate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]reflect.Type, 0, len(c.providers))
+	for key := range c.providers {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b reflect.Type) int { return strings.Compare(a.String(), b.String()) })
+
+	var errs []error
+	reported := map[string]bool{}
+	report := func(err error) {
+		if !reported[err.Error()] {
+			reported[err.Error()] = true
+			errs = append(errs, err)
+		}
+	}
+
+	done := map[reflect.Type]bool{}
+	var visit func(key reflect.Type, path []reflect.Type)
+	visit = func(key reflect.Type, path []reflect.Type) {
+		if i := slices.Index(path, key); i >= 0 {
+			report(fmt.Errorf("%w: %s", ErrCycle, formatPath(append(path[i:], key))))
+			return
+		}
+		if done[key] {
+			return
+		}
+		p, ok := c.providers[key]
+		if !ok {
+			report(fmt.Errorf("%s: %w", formatPath(append(path, key)), ErrNotRegistered))
+			return
+		}
+
+		path = append(path, key)
+		for _, dep := range p.deps {
+			if d, ok := c.providers[dep]; ok && p.lifetime == Singleton && d.lifetime == Transient {
+				report(fmt.Errorf("singleton %s depends on transient %s and would keep a single instance of it", key, dep))
+			}
+			visit(dep, slices.Clip(path))
+		}
+		done[key] = true
+	}
+	for _, key := range keys {
+		visit(key, nil)
+	}
+	return errors.Join(errs...)
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+func formatPath(path []reflect.Type) string {
+	names := make([]string, len(path))
+	for i, t := range path {
+		names[i] = t.String()
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,206 @@
+package di
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type (
+	config  struct{ name string }
+	service struct{ cfg *config }
+	handler struct{ svc *service }
+)
+
+func TestResolveNilProvider(t *testing.T) {
+	c := New()
+	if err := Provide[io.Reader](c, Transient, func() io.Reader { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve[io.Reader](c); !errors.Is(err, ErrProvider) {
+		t.Errorf("Resolve with a provider returning nil = %v, want %v", err, ErrProvider)
+	}
+}
+
+func TestResolveNilKinds(t *testing.T) {
+	c := New()
+	Provide[*config](c, Transient, func() *config { return nil })
+	Provide[map[string]int](c, Transient, func() map[string]int { return nil })
+	Provide[func()](c, Transient, func() func() { return nil })
+	Provide[chan int](c, Transient, func() chan int { return nil })
+
+	for name, resolve := range map[string]func() error{
+		"pointer": func() error { _, err := Resolve[*config](c); return err },
+		"map":     func() error { _, err := Resolve[map[string]int](c); return err },
+		"func":    func() error { _, err := Resolve[func()](c); return err },
+		"chan":    func() error { _, err := Resolve[chan int](c); return err },
+	} {
+		if err := resolve(); !errors.Is(err, ErrProvider) {
+			t.Errorf("Resolve with a provider returning a nil %s = %v, want %v", name, err, ErrProvider)
+		}
+	}
+}
+
+func TestProvideErrors(t *testing.T) {
+	c := New()
+	if err := Provide[*config](c, Singleton, func() *config { return &config{} }); err != nil {
+		t.Fatal(err)
+	}
+	for name, constructor := range map[string]any{
+		"not a function": &config{},
+		"variadic":       func(...int) *config { return nil },
+		"no result":      func() {},
+		"wrong type":     func() *service { return nil },
+		"not an error":   func() (*config, int) { return nil, 0 },
+	} {
+		if err := Provide[*config](New(), Singleton, constructor); !errors.Is(err, ErrProvider) {
+			t.Errorf("Provide(%s) = %v, want %v", name, err, ErrProvider)
+		}
+	}
+	if err := Provide[*config](c, Singleton, func() *config { return &config{} }); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Provide twice = %v, want %v", err, ErrDuplicate)
+	}
+}
+
+func TestLifetimes(t *testing.T) {
+	for _, tc := range []struct {
+		lifetime Lifetime
+		calls    int32
+	}{
+		{Singleton, 1},
+		{Transient, 3},
+	} {
+		c := New()
+		var calls atomic.Int32
+		Provide[*config](c, tc.lifetime, func() *config {
+			calls.Add(1)
+			return &config{name: "test"}
+		})
+		Provide[*service](c, Transient, func(cfg *config) *service { return &service{cfg} })
+
+		first := MustResolve[*config](c)
+		second := MustResolve[*service](c).cfg
+		MustResolve[*service](c)
+		if got := calls.Load(); got != tc.calls {
+			t.Errorf("%s: the constructor ran %d times, want %d", tc.lifetime, got, tc.calls)
+		}
+		if shared := first == second; shared != (tc.lifetime == Singleton) {
+			t.Errorf("%s: instances shared = %v", tc.lifetime, shared)
+		}
+	}
+}
+
+func TestSingletonConcurrent(t *testing.T) {
+	c := New()
+	var calls atomic.Int32
+	Provide[*config](c, Singleton, func() *config {
+		calls.Add(1)
+		return &config{}
+	})
+
+	var wg sync.WaitGroup
+	results := make([]*config, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = MustResolve[*config](c)
+		}()
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("the singleton was built %d times, want 1", got)
+	}
+	for _, r := range results {
+		if r != results[0] {
+			t.Fatal("goroutines got different singletons")
+		}
+	}
+}
+
+func TestResolveFromConstructor(t *testing.T) {
+	c := New()
+	Provide[*config](c, Singleton, func() *config { return &config{name: "test"} })
+	// a constructor resolving from the container does not deadlock
+	Provide[*service](c, Singleton, func() (*service, error) {
+		cfg, err := Resolve[*config](c)
+		return &service{cfg}, err
+	})
+
+	done := make(chan *service)
+	go func() { done <- MustResolve[*service](c) }()
+	if svc := <-done; svc.cfg.name != "test" {
+		t.Errorf("resolved %+v, want the test config", svc.cfg)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	c := New()
+	Provide[*config](c, Singleton, func(*handler) *config { return &config{} })
+	Provide[*service](c, Singleton, func(cfg *config) *service { return &service{cfg} })
+	Provide[*handler](c, Singleton, func(svc *service) *handler { return &handler{svc} })
+	_, err := Resolve[*handler](c)
+	if !errors.Is(err, ErrCycle) || !strings.Contains(err.Error(), "*di.handler -> *di.service -> *di.config -> *di.handler") {
+		t.Errorf("Resolve with a cycle = %v, want %v with the path", err, ErrCycle)
+	}
+
+	c = New()
+	Provide[*service](c, Singleton, func(cfg *config) *service { return &service{cfg} })
+	if _, err := Resolve[*service](c); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("Resolve with a missing dependency = %v, want %v", err, ErrNotRegistered)
+	}
+
+	// a failed singleton is not kept, the next resolution tries again
+	c = New()
+	fail := errors.New("unavailable")
+	calls := 0
+	Provide[*config](c, Singleton, func() (*config, error) {
+		calls++
+		if calls == 1 {
+			return nil, fail
+		}
+		return &config{}, nil
+	})
+	if _, err := Resolve[*config](c); !errors.Is(err, fail) {
+		t.Errorf("Resolve with a failing constructor = %v, want %v", err, fail)
+	}
+	if _, err := Resolve[*config](c); err != nil {
+		t.Errorf("Resolve after a failure = %v, want it built", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := New()
+	Provide[*config](c, Transient, func() *config { return &config{} })
+	Provide[*service](c, Singleton, func(cfg *config) *service { return &service{cfg} })
+	Provide[*handler](c, Singleton, func(svc *service) *handler { return &handler{svc} })
+	Provide[io.Reader](c, Singleton, func(io.Writer) io.Reader { return nil })
+	Provide[io.Writer](c, Singleton, func(io.Closer, io.Reader) io.Writer { return nil })
+
+	err := c.Validate()
+	for _, want := range []error{ErrCycle, ErrNotRegistered} {
+		if !errors.Is(err, want) {
+			t.Errorf("Validate() = %v, want %v", err, want)
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "singleton *di.service depends on transient *di.config") {
+		t.Errorf("Validate() = %v, want the singleton capturing a transient", err)
+	}
+	if n := strings.Count(err.Error(), "\n") + 1; n != 3 {
+		t.Errorf("Validate() reported %d problems, want 3:\n%v", n, err)
+	}
+
+	c = New()
+	var built bool
+	Provide[*config](c, Singleton, func() *config { built = true; return &config{} })
+	Provide[*service](c, Transient, func(cfg *config) *service { return &service{cfg} })
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() of a valid graph = %v", err)
+	}
+	if built {
+		t.Error("Validate built a value")
+	}
+}
@@ -0,0 +1,206 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"dip/book"
+)
+
+// Store keeps books in a JSON file. The whole file is rewritten on every
+// change, which is fine for a small catalogue.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	books []book.Book
+}
+
+// Open loads the books from path, a missing file is an empty store
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.books); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) AddBook(b book.Book) (*book.Book, error) {
+	b, err := b.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUnique(b, -1); err != nil {
+		return nil, err
+	}
+	s.books = append(s.books, b.Clone())
+	if err := s.save(); err != nil {
+		s.books = s.books[:len(s.books)-1]
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *Store) FindBook(title string) (*book.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(title)
+	if i < 0 {
+		return nil, fmt.Errorf("%q: %w", title, book.ErrNotFound)
+	}
+	bk := s.books[i].Clone()
+	return &bk, nil
+}
+
+// FindByISBN accepts an ISBN-10 or ISBN-13
+func (s *Store) FindByISBN(isbn string) (*book.Book, error) {
+	isbn, err := book.NormalizeISBN(isbn)
+	if err != nil {
+		return nil, err
+	}
+	found := s.filter(func(b book.Book) bool { return b.ISBN == isbn })
+	if len(found) == 0 {
+		return nil, fmt.Errorf("ISBN %s: %w", isbn, book.ErrNotFound)
+	}
+	return &found[0], nil
+}
+
+func (s *Store) FindByAuthor(author string) ([]book.Book, error) {
+	return s.filter(func(b book.Book) bool { return b.HasAuthor(author) }), nil
+}
+
+// FindByTitlePrefix ignores case
+func (s *Store) FindByTitlePrefix(prefix string) ([]book.Book, error) {
+	return s.filter(func(b book.Book) bool { return book.HasPrefixFold(b.Title, prefix) }), nil
+}
+
+func (s *Store) ListBooks(offset, limit int) ([]book.Book, error) {
+	return book.Paginate(s.filter(func(book.Book) bool { return true }), offset, limit)
+}
+
+func (s *Store) UpdateBook(title string, b book.Book) error {
+	b, err := b.Normalize()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(title)
+	if i < 0 {
+		return fmt.Errorf("%q: %w", title, book.ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.checkUnique(b, i); err != nil {
+		return err
+	}
+
+	old := s.books[i]
+	s.books[i] = b
+	if err := s.save(); err != nil {
+		s.books[i] = old
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeleteBook(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(title)
+	if i < 0 {
+		return fmt.Errorf("%q: %w", title, book.ErrNotFound)
+	}
+
+	old := slices.Clone(s.books)
+	s.books = slices.Delete(s.books, i, i+1)
+	if err := s.save(); err != nil {
+		s.books = old
+		return err
+	}
+	return nil
+}
+
+// index expects the caller to hold the lock
+func (s *Store) index(title string) int {
+	return slices.IndexFunc(s.books, func(b book.Book) bool { return b.Title == title })
+}
+
+// checkUnique ignores the book at index self, the one being updated.
+// It expects the caller to hold the lock.
+func (s *Store) checkUnique(b book.Book, self int) error {
+	for i, other := range s.books {
+		if i == self {
+			continue
+		}
+		if other.Title == b.Title {
+			return fmt.Errorf("%q: %w", b.Title, book.ErrDuplicate)
+		}
+		if b.ISBN != "" && other.ISBN == b.ISBN {
+			return fmt.Errorf("ISBN %s: %w", b.ISBN, book.ErrDuplicate)
+		}
+	}
+	return nil
+}
+
+// filter returns a sorted copy of the matching books
+func (s *Store) filter(match func(book.Book) bool) []book.Book {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []book.Book{}
+	for _, b := range s.books {
+		if match(b) {
+			result = append(result, b.Clone())
+		}
+	}
+	book.SortByTitle(result)
+	return result
+}
+
+// save writes to a temporary file first, so a crash never leaves
+// a half written catalogue behind
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.books, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
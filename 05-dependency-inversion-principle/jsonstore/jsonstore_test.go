@@ -0,0 +1,30 @@
+package jsonstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"dip/book"
+	"dip/book/booktest"
+)
+
+func TestStore(t *testing.T) {
+	err := booktest.CheckBookStorageV2(func() book.BookStorageV2 {
+		s, err := Open(filepath.Join(t.TempDir(), "books.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	err := booktest.CheckPersistence(func() (book.BookStorageV2, error) { return Open(path) })
+	if err != nil {
+		t.Error(err)
+	}
+}
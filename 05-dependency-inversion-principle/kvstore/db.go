@@ -0,0 +1,291 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DB is a small embedded key-value store kept in a single append-only file.
+// Every record is checksummed, only the offsets of the latest values are
+// held in memory and values are read from disk on demand.
+//
+// record layout: crc32 | key length | value length | key | value
+// a value length of tombstone marks a deleted key, a key length of batch
+// marks a batch whose value is a sequence of records without checksums:
+// key length | value length | key | value
+type DB struct {
+	mu    sync.RWMutex
+	f     *os.File
+	size  int64
+	index map[string]entry
+}
+
+type entry struct {
+	offset int64
+	length uint32
+}
+
+const (
+	headerSize      = 12
+	batchHeaderSize = 8
+	tombstone       = ^uint32(0)
+	batch           = ^uint32(0)
+)
+
+var (
+	ErrClosed  = errors.New("kvstore: database is closed")
+	ErrCorrupt = errors.New("kvstore: corrupt record")
+)
+
+// OpenDB opens or creates the database file at path. The last record, when
+// it was only partially written, e.g. during a crash, is discarded. A
+// record that does not match its checksum anywhere else is ErrCorrupt: the
+// file is left as it is.
+func OpenDB(path string) (*DB, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{f: f, index: map[string]entry{}}
+	if err := db.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) load() error {
+	info, err := db.f.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	header := make([]byte, headerSize)
+	for {
+		// nothing left is the end of the file, a short header a torn tail
+		if _, err := db.f.ReadAt(header, db.size); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		sum := binary.BigEndian.Uint32(header[0:4])
+		keyLen := binary.BigEndian.Uint32(header[4:8])
+		valLen := binary.BigEndian.Uint32(header[8:12])
+
+		bodyLen := int64(keyLen)
+		switch {
+		case keyLen == batch:
+			bodyLen = int64(valLen)
+		case valLen != tombstone:
+			bodyLen += int64(valLen)
+		}
+		// the header is not verified yet, a garbage length must not be
+		// trusted with an allocation: a record past the end of the file
+		// is a torn tail
+		end := db.size + headerSize + bodyLen
+		if end > fileSize {
+			break
+		}
+		body := make([]byte, bodyLen)
+		if _, err := db.f.ReadAt(body, db.size+headerSize); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(append(header[4:12:12], body...)) != sum {
+			// the last record may have been written only partly even
+			// though the file grew to its full length
+			if end == fileSize {
+				break
+			}
+			return fmt.Errorf("%w at offset %d", ErrCorrupt, db.size)
+		}
+
+		if keyLen == batch {
+			if err := db.applyBatch(body, db.size+headerSize); err != nil {
+				return err
+			}
+		} else {
+			db.apply(string(body[:keyLen]), db.size+headerSize+int64(keyLen), valLen)
+		}
+		db.size = end
+	}
+
+	// drop the torn tail
+	return db.f.Truncate(db.size)
+}
+
+// apply updates the index with a record whose value is at offset. It
+// expects the caller to hold the lock.
+func (db *DB) apply(key string, offset int64, valLen uint32) {
+	if valLen == tombstone {
+		delete(db.index, key)
+	} else {
+		db.index[key] = entry{offset: offset, length: valLen}
+	}
+}
+
+// applyBatch applies the records of a batch read at offset. It expects the
+// caller to hold the lock.
+func (db *DB) applyBatch(body []byte, offset int64) error {
+	for pos := int64(0); pos < int64(len(body)); {
+		if int64(len(body))-pos < batchHeaderSize {
+			return fmt.Errorf("%w: batch at offset %d", ErrCorrupt, offset-headerSize)
+		}
+		keyLen := int64(binary.BigEndian.Uint32(body[pos : pos+4]))
+		valLen := binary.BigEndian.Uint32(body[pos+4 : pos+8])
+		n := batchHeaderSize + keyLen
+		if valLen != tombstone {
+			n += int64(valLen)
+		}
+		if n > int64(len(body))-pos {
+			return fmt.Errorf("%w: batch at offset %d", ErrCorrupt, offset-headerSize)
+		}
+		key := string(body[pos+batchHeaderSize : pos+batchHeaderSize+keyLen])
+		db.apply(key, offset+pos+batchHeaderSize+keyLen, valLen)
+		pos += n
+	}
+	return nil
+}
+
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.f == nil {
+		return nil, false, ErrClosed
+	}
+	e, ok := db.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+	value := make([]byte, e.length)
+	if _, err := db.f.ReadAt(value, e.offset); err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (db *DB) Put(key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	offset, err := db.append(uint32(len(key)), uint32(len(value)), []byte(key), value)
+	if err != nil {
+		return err
+	}
+	db.apply(key, offset+int64(len(key)), uint32(len(value)))
+	return nil
+}
+
+func (db *DB) Delete(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.index[key]; !ok {
+		return nil
+	}
+	if _, err := db.append(uint32(len(key)), tombstone, []byte(key)); err != nil {
+		return err
+	}
+	db.apply(key, 0, tombstone)
+	return nil
+}
+
+// Batch is a set of puts and deletes that Write stores as a single record:
+// after a crash either all of them are there or none is
+type Batch struct {
+	body []byte
+}
+
+func (b *Batch) Put(key string, value []byte) {
+	b.add(key, value, uint32(len(value)))
+}
+
+func (b *Batch) Delete(key string) {
+	b.add(key, nil, tombstone)
+}
+
+func (b *Batch) add(key string, value []byte, valLen uint32) {
+	b.body = binary.BigEndian.AppendUint32(b.body, uint32(len(key)))
+	b.body = binary.BigEndian.AppendUint32(b.body, valLen)
+	b.body = append(b.body, key...)
+	b.body = append(b.body, value...)
+}
+
+// Write applies the operations of the batch in the order they were added
+func (db *DB) Write(b *Batch) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(b.body) == 0 {
+		return nil
+	}
+	offset, err := db.append(batch, uint32(len(b.body)), b.body)
+	if err != nil {
+		return err
+	}
+	return db.applyBatch(b.body, offset)
+}
+
+// Keys returns every key starting with prefix, in sorted order
+func (db *DB) Keys(prefix string) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := []string{}
+	for k := range db.index {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.f == nil {
+		return ErrClosed
+	}
+	err := db.f.Close()
+	db.f = nil
+	return err
+}
+
+// append writes and syncs one record made of the parts of its body and
+// returns the offset of the body. It expects the caller to hold the lock.
+func (db *DB) append(keyLen, valLen uint32, body ...[]byte) (int64, error) {
+	if db.f == nil {
+		return 0, ErrClosed
+	}
+
+	record := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(record[4:8], keyLen)
+	binary.BigEndian.PutUint32(record[8:12], valLen)
+	for _, part := range body {
+		record = append(record, part...)
+	}
+	binary.BigEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(record[4:]))
+
+	if _, err := db.f.WriteAt(record, db.size); err != nil {
+		return 0, err
+	}
+	if err := db.f.Sync(); err != nil {
+		return 0, err
+	}
+
+	offset := db.size + headerSize
+	db.size += int64(len(record))
+	return offset, nil
+}
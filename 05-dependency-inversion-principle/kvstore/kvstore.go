@@ -0,0 +1,237 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"dip/book"
+)
+
+// Store keeps books in an embedded key-value database. Books are stored
+// under their title and an index maps every ISBN to its title. Both keys of
+// a book are written in a single batch, so they never disagree.
+type Store struct {
+	mu sync.Mutex // serializes the check-then-write sequences
+	db *DB
+}
+
+const (
+	titlePrefix = "title/"
+	isbnPrefix  = "isbn/"
+)
+
+func Open(path string) (*Store, error) {
+	db, err := OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) AddBook(b book.Book) (*book.Book, error) {
+	b, err := b.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUnique(b, ""); err != nil {
+		return nil, err
+	}
+	wb := &Batch{}
+	if err := put(wb, b); err != nil {
+		return nil, err
+	}
+	if err := s.db.Write(wb); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *Store) FindBook(title string) (*book.Book, error) {
+	bk, ok, err := s.get(title)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", title, book.ErrNotFound)
+	}
+	return &bk, nil
+}
+
+// FindByISBN accepts an ISBN-10 or ISBN-13
+func (s *Store) FindByISBN(isbn string) (*book.Book, error) {
+	isbn, err := book.NormalizeISBN(isbn)
+	if err != nil {
+		return nil, err
+	}
+	title, ok, err := s.db.Get(isbnPrefix + isbn)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("ISBN %s: %w", isbn, book.ErrNotFound)
+	}
+	return s.FindBook(string(title))
+}
+
+// FindByAuthor reads every book, authors are not indexed
+func (s *Store) FindByAuthor(author string) ([]book.Book, error) {
+	result := []book.Book{}
+	for _, key := range s.db.Keys(titlePrefix) {
+		bk, ok, err := s.get(strings.TrimPrefix(key, titlePrefix))
+		if err != nil {
+			return nil, err
+		}
+		if ok && bk.HasAuthor(author) {
+			result = append(result, bk)
+		}
+	}
+	return result, nil
+}
+
+// FindByTitlePrefix ignores case
+func (s *Store) FindByTitlePrefix(prefix string) ([]book.Book, error) {
+	result := []book.Book{}
+	for _, key := range s.db.Keys(titlePrefix) {
+		title := strings.TrimPrefix(key, titlePrefix)
+		if !book.HasPrefixFold(title, prefix) {
+			continue
+		}
+		bk, ok, err := s.get(title)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, bk)
+		}
+	}
+	return result, nil
+}
+
+// ListBooks only reads the books of the requested page
+func (s *Store) ListBooks(offset, limit int) ([]book.Book, error) {
+	keys := s.db.Keys(titlePrefix)
+	if offset < 0 || limit < 1 {
+		return nil, fmt.Errorf("invalid page offset %d, limit %d", offset, limit)
+	}
+
+	result := []book.Book{}
+	for i := offset; i < len(keys) && i < offset+limit; i++ {
+		bk, ok, err := s.get(strings.TrimPrefix(keys[i], titlePrefix))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, bk)
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) UpdateBook(title string, b book.Book) error {
+	b, err := b.Normalize()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok, getErr := s.get(title)
+	if getErr != nil {
+		return getErr
+	}
+	if !ok {
+		return fmt.Errorf("%q: %w", title, book.ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.checkUnique(b, title); err != nil {
+		return err
+	}
+
+	wb := &Batch{}
+	if err := put(wb, b); err != nil {
+		return err
+	}
+	if old.Title != b.Title {
+		wb.Delete(titlePrefix + old.Title)
+	}
+	if old.ISBN != "" && old.ISBN != b.ISBN {
+		wb.Delete(isbnPrefix + old.ISBN)
+	}
+	return s.db.Write(wb)
+}
+
+func (s *Store) DeleteBook(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok, err := s.get(title)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%q: %w", title, book.ErrNotFound)
+	}
+	wb := &Batch{}
+	wb.Delete(titlePrefix + title)
+	if old.ISBN != "" {
+		wb.Delete(isbnPrefix + old.ISBN)
+	}
+	return s.db.Write(wb)
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// checkUnique ignores the book stored under self, the one being updated.
+// It expects the caller to hold the lock.
+func (s *Store) checkUnique(b book.Book, self string) error {
+	if b.Title != self {
+		if _, ok, err := s.db.Get(titlePrefix + b.Title); err != nil {
+			return err
+		} else if ok {
+			return fmt.Errorf("%q: %w", b.Title, book.ErrDuplicate)
+		}
+	}
+	if b.ISBN != "" {
+		title, ok, err := s.db.Get(isbnPrefix + b.ISBN)
+		if err != nil {
+			return err
+		}
+		if ok && string(title) != self {
+			return fmt.Errorf("ISBN %s: %w", b.ISBN, book.ErrDuplicate)
+		}
+	}
+	return nil
+}
+
+func (s *Store) get(title string) (book.Book, bool, error) {
+	bk := book.Book{}
+	value, ok, err := s.db.Get(titlePrefix + title)
+	if err != nil || !ok {
+		return bk, ok, err
+	}
+	if err := json.Unmarshal(value, &bk); err != nil {
+		return bk, false, err
+	}
+	return bk, true, nil
+}
+
+// put adds the keys of a book to the batch
+func put(wb *Batch, bk book.Book) error {
+	value, err := json.Marshal(bk)
+	if err != nil {
+		return err
+	}
+	wb.Put(titlePrefix+bk.Title, value)
+	if bk.ISBN != "" {
+		wb.Put(isbnPrefix+bk.ISBN, []byte(bk.Title))
+	}
+	return nil
+}
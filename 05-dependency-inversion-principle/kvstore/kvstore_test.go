@@ -0,0 +1,207 @@
+package kvstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dip/book"
+	"dip/book/booktest"
+)
+
+func TestStore(t *testing.T) {
+	err := booktest.CheckBookStorageV2(func() book.BookStorageV2 {
+		s, err := Open(filepath.Join(t.TempDir(), "books.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	err := booktest.CheckPersistence(func() (book.BookStorageV2, error) { return Open(path) })
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenDBTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a header claiming lengths of 4 GB, followed by too little data
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xfe, 0xff, 0xff, 0xff, 0xfe, 'k', 'e', 'y'})
+	f.Close()
+
+	db, err = OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB with a torn tail: %v", err)
+	}
+	defer db.Close()
+	if value, ok, err := db.Get("key"); err != nil || !ok || string(value) != "value" {
+		t.Errorf("Get(key) = %q, %v, %v, want the value stored before the torn tail", value, ok, err)
+	}
+	if after, err := os.Stat(path); err != nil || after.Size() != info.Size() {
+		t.Errorf("the torn tail was not truncated: %v, %v", after, err)
+	}
+}
+
+// putAll writes the values to a new database at path and returns the size
+// of the file after each of them
+func putAll(t *testing.T, path string, values ...string) []int64 {
+	t.Helper()
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sizes := []int64{}
+	for _, v := range values {
+		if err := db.Put(v, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, db.size)
+	}
+	return sizes
+}
+
+// flip changes the byte at offset of the file
+func flip(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenDBCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	sizes := putAll(t, path, "a", "b", "c")
+
+	// the value of b, in the middle of the file
+	flip(t, path, sizes[1]-1)
+	if _, err := OpenDB(path); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("OpenDB with a corrupt record in the middle = %v, want %v", err, ErrCorrupt)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != sizes[2] {
+		t.Errorf("the file was changed: %v, %v, want %d bytes", info, err, sizes[2])
+	}
+}
+
+func TestOpenDBTornLastRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	sizes := putAll(t, path, "a", "b")
+
+	// the last record is complete but does not match its checksum
+	flip(t, path, sizes[1]-1)
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB with a torn last record: %v", err)
+	}
+	defer db.Close()
+	if _, ok, _ := db.Get("a"); !ok {
+		t.Error("the record before the torn one is lost")
+	}
+	if _, ok, _ := db.Get("b"); ok {
+		t.Error("the torn record was kept")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != sizes[0] {
+		t.Errorf("the torn record was not truncated: %v, %v", info, err)
+	}
+}
+
+func TestStoreTornBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddBook(book.Book{Title: "Harry Potter", Author: "J.K. Rowling"}); err != nil {
+		t.Fatal(err)
+	}
+	before := s.db.size
+	if _, err := s.AddBook(book.Book{Title: "A Brief History of Time", Author: "Stephen Hawking", ISBN: "978-0-553-38016-3"}); err != nil {
+		t.Fatal(err)
+	}
+	after := s.db.size
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash in the middle of the batch holding the title and the ISBN
+	if err := os.Truncate(path, (before+after)/2); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.FindBook("Harry Potter"); err != nil {
+		t.Errorf("the book added before the crash: %v", err)
+	}
+	if _, err := s.FindBook("A Brief History of Time"); !errors.Is(err, book.ErrNotFound) {
+		t.Errorf("FindBook of the torn book = %v, want %v", err, book.ErrNotFound)
+	}
+	if _, err := s.FindByISBN("978-0-553-38016-3"); !errors.Is(err, book.ErrNotFound) {
+		t.Errorf("FindByISBN of the torn book = %v, want %v", err, book.ErrNotFound)
+	}
+}
+
+func TestDBBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	putAll(t, path, "a", "b")
+
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wb := &Batch{}
+	wb.Put("c", []byte("c"))
+	wb.Delete("a")
+	wb.Put("b", []byte("new b"))
+	if err := db.Write(wb); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the batch is replayed when the file is opened again
+	db, err = OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if keys := db.Keys(""); len(keys) != 2 || keys[0] != "b" || keys[1] != "c" {
+		t.Errorf("keys %q, want b and c", keys)
+	}
+	if value, _, _ := db.Get("b"); string(value) != "new b" {
+		t.Errorf("b = %q, want new b", value)
+	}
+}
@@ -0,0 +1,350 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"dip/book"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrDuplicate        = errors.New("already exists")
+	ErrUnavailable      = errors.New("copy is on loan")
+	ErrReserved         = errors.New("every free copy is reserved for other members")
+	ErrLoanLimit        = errors.New("loan limit reached")
+	ErrFinesOutstanding = errors.New("outstanding fines")
+	ErrReturned         = errors.New("copy is not on loan")
+)
+
+type Member struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Copy is one physical copy of a book in the catalogue
+type Copy struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type Loan struct {
+	ID         int       `json:"id"`
+	CopyID     string    `json:"copy_id"`
+	MemberID   string    `json:"member_id"`
+	BorrowedAt time.Time `json:"borrowed_at"`
+	DueAt      time.Time `json:"due_at"`
+	ReturnedAt time.Time `json:"returned_at"`    // zero while on loan
+	Fine       int       `json:"fine,omitempty"` // in cents, set on return
+	FinePaid   bool      `json:"fine_paid,omitempty"`
+}
+
+func (l Loan) Active() bool {
+	return l.ReturnedAt.IsZero()
+}
+
+// Hold reserves the next free copy of a title, first come first served
+type Hold struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	MemberID string    `json:"member_id"`
+	PlacedAt time.Time `json:"placed_at"`
+}
+
+// the library only depends on these narrow storages and on
+// book.BookStorageV2, never on how any of them is implemented
+
+type MemberStorage interface {
+	AddMember(m Member) error
+	FindMember(id string) (*Member, error)
+}
+
+type CopyStorage interface {
+	AddCopy(c Copy) error
+	FindCopy(id string) (*Copy, error)
+	CopiesOf(title string) ([]Copy, error)
+}
+
+type LoanStorage interface {
+	AddLoan(l *Loan) error
+	UpdateLoan(l Loan) error
+	LoansOf(memberId string) ([]Loan, error)
+	ActiveLoans() ([]Loan, error)
+}
+
+type HoldStorage interface {
+	AddHold(h *Hold) error
+	RemoveHold(id int) error
+	HoldsOn(title string) ([]Hold, error) // oldest first
+}
+
+type Config struct {
+	LoanPeriod          time.Duration
+	DailyFine           int // in cents
+	MaxFine             int // per loan, in cents
+	MaxLoans            int
+	MaxOutstandingFines int // borrowing is blocked above this, in cents
+	Now                 func() time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		LoanPeriod:          14 * 24 * time.Hour,
+		DailyFine:           25,
+		MaxFine:             1000,
+		MaxLoans:            5,
+		MaxOutstandingFines: 500,
+		Now:                 time.Now,
+	}
+}
+
+type Library struct {
+	mu      sync.Mutex // a checkout reads and writes several storages
+	books   book.BookStorageV2
+	members MemberStorage
+	copies  CopyStorage
+	loans   LoanStorage
+	holds   HoldStorage
+	cfg     Config
+}
+
+// NewLibrary takes the fields of cfg that are zero from DefaultConfig
+func NewLibrary(books book.BookStorageV2, members MemberStorage, copies CopyStorage, loans LoanStorage, holds HoldStorage, cfg Config) *Library {
+	def := DefaultConfig()
+	orDefault(&cfg.LoanPeriod, def.LoanPeriod)
+	orDefault(&cfg.DailyFine, def.DailyFine)
+	orDefault(&cfg.MaxFine, def.MaxFine)
+	orDefault(&cfg.MaxLoans, def.MaxLoans)
+	orDefault(&cfg.MaxOutstandingFines, def.MaxOutstandingFines)
+	if cfg.Now == nil {
+		cfg.Now = def.Now
+	}
+	return &Library{books: books, members: members, copies: copies, loans: loans, holds: holds, cfg: cfg}
+}
+
+func orDefault[T comparable](field *T, def T) {
+	var zero T
+	if *field == zero {
+		*field = def
+	}
+}
+
+func (l *Library) AddMember(m Member) error {
+	return l.members.AddMember(m)
+}
+
+// AddCopy only accepts copies of books that are in the catalogue
+func (l *Library) AddCopy(c Copy) error {
+	if _, err := l.books.FindBook(c.Title); err != nil {
+		return err
+	}
+	return l.copies.AddCopy(c)
+}
+
+func (l *Library) Checkout(memberId, copyId string) (*Loan, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.members.FindMember(memberId); err != nil {
+		return nil, err
+	}
+	c, err := l.copies.FindCopy(copyId)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := l.loans.ActiveLoans()
+	if err != nil {
+		return nil, err
+	}
+	onLoan := map[string]bool{}
+	count := 0
+	for _, loan := range active {
+		onLoan[loan.CopyID] = true
+		if loan.MemberID == memberId {
+			count++
+		}
+	}
+	if onLoan[copyId] {
+		return nil, fmt.Errorf("copy %s: %w", copyId, ErrUnavailable)
+	}
+	if count >= l.cfg.MaxLoans {
+		return nil, fmt.Errorf("member %s has %d loans: %w", memberId, count, ErrLoanLimit)
+	}
+	fines, err := l.outstandingFines(memberId)
+	if err != nil {
+		return nil, err
+	}
+	if fines > l.cfg.MaxOutstandingFines {
+		return nil, fmt.Errorf("member %s owes %d: %w", memberId, fines, ErrFinesOutstanding)
+	}
+
+	// members holding the title go first: this member may only take a free
+	// copy if there are more free copies than holds placed before theirs
+	holds, err := l.holds.HoldsOn(c.Title)
+	if err != nil {
+		return nil, err
+	}
+	position := slices.IndexFunc(holds, func(h Hold) bool { return h.MemberID == memberId })
+	if position < 0 {
+		position = len(holds)
+	}
+	copies, err := l.copies.CopiesOf(c.Title)
+	if err != nil {
+		return nil, err
+	}
+	free := 0
+	for _, cp := range copies {
+		if !onLoan[cp.ID] {
+			free++
+		}
+	}
+	if position >= free {
+		return nil, fmt.Errorf("%q: %w", c.Title, ErrReserved)
+	}
+	if position < len(holds) {
+		if err := l.holds.RemoveHold(holds[position].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := l.cfg.Now()
+	loan := Loan{CopyID: copyId, MemberID: memberId, BorrowedAt: now, DueAt: now.Add(l.cfg.LoanPeriod)}
+	if err := l.loans.AddLoan(&loan); err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// Return closes the loan of a copy and charges a fine when it is late
+func (l *Library) Return(copyId string) (*Loan, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	active, err := l.loans.ActiveLoans()
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(active, func(loan Loan) bool { return loan.CopyID == copyId })
+	if i < 0 {
+		return nil, fmt.Errorf("copy %s: %w", copyId, ErrReturned)
+	}
+	loan := &active[i]
+
+	loan.ReturnedAt = l.cfg.Now()
+	loan.Fine = l.fine(*loan, loan.ReturnedAt)
+	if err := l.loans.UpdateLoan(*loan); err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+func (l *Library) PlaceHold(memberId, title string) (*Hold, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.members.FindMember(memberId); err != nil {
+		return nil, err
+	}
+	if _, err := l.books.FindBook(title); err != nil {
+		return nil, err
+	}
+	holds, err := l.holds.HoldsOn(title)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(holds, func(h Hold) bool { return h.MemberID == memberId }) {
+		return nil, fmt.Errorf("hold on %q by %s: %w", title, memberId, ErrDuplicate)
+	}
+
+	h := Hold{Title: title, MemberID: memberId, PlacedAt: l.cfg.Now()}
+	if err := l.holds.AddHold(&h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (l *Library) CancelHold(holdId int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holds.RemoveHold(holdId)
+}
+
+// Overdue lists the loans that are past their due date
+func (l *Library) Overdue() ([]Loan, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	active, err := l.loans.ActiveLoans()
+	if err != nil {
+		return nil, err
+	}
+	now := l.cfg.Now()
+	result := []Loan{}
+	for _, loan := range active {
+		if now.After(loan.DueAt) {
+			result = append(result, loan)
+		}
+	}
+	return result, nil
+}
+
+// OutstandingFines adds the unpaid fines of returned loans to the fines
+// that overdue loans have accrued so far
+func (l *Library) OutstandingFines(memberId string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.outstandingFines(memberId)
+}
+
+func (l *Library) outstandingFines(memberId string) (int, error) {
+	loans, err := l.loans.LoansOf(memberId)
+	if err != nil {
+		return 0, err
+	}
+	now := l.cfg.Now()
+	total := 0
+	for _, loan := range loans {
+		switch {
+		case loan.Active():
+			total += l.fine(loan, now)
+		case !loan.FinePaid:
+			total += loan.Fine
+		}
+	}
+	return total, nil
+}
+
+// PayFines settles the fines of every returned loan of a member
+func (l *Library) PayFines(memberId string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	loans, err := l.loans.LoansOf(memberId)
+	if err != nil {
+		return err
+	}
+	for _, loan := range loans {
+		if loan.Active() || loan.FinePaid || loan.Fine == 0 {
+			continue
+		}
+		loan.FinePaid = true
+		if err := l.loans.UpdateLoan(loan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fine charges every started day past the due date, up to the maximum
+func (l *Library) fine(loan Loan, at time.Time) int {
+	late := at.Sub(loan.DueAt)
+	if late <= 0 {
+		return 0
+	}
+	days := int((late + 24*time.Hour - 1) / (24 * time.Hour))
+	return min(days*l.cfg.DailyFine, l.cfg.MaxFine)
+}
@@ -0,0 +1,235 @@
+package library
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dip/book"
+)
+
+// testLibrary has two copies of Dune, one of Emma, members ann, bob and
+// cat, and a clock the test moves forward
+type testLibrary struct {
+	*Library
+	now time.Time
+}
+
+func newTestLibrary(t *testing.T, cfg Config) *testLibrary {
+	t.Helper()
+	books := book.NewBookSliceAdapter(&book.BookSlice{})
+	for _, title := range []string{"Dune", "Emma"} {
+		if _, err := books.AddBook(book.Book{Title: title, Author: "Someone"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem := NewMemory()
+	tl := &testLibrary{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	cfg.Now = func() time.Time { return tl.now }
+	tl.Library = NewLibrary(books, mem, mem, mem, mem, cfg)
+
+	for _, id := range []string{"ann", "bob", "cat"} {
+		if err := tl.AddMember(Member{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []Copy{{"dune-1", "Dune"}, {"dune-2", "Dune"}, {"emma-1", "Emma"}} {
+		if err := tl.AddCopy(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tl
+}
+
+func (tl *testLibrary) days(n int) {
+	tl.now = tl.now.Add(time.Duration(n) * 24 * time.Hour)
+}
+
+func TestCheckoutAndReturn(t *testing.T) {
+	lib := newTestLibrary(t, DefaultConfig())
+
+	loan, err := lib.Checkout("ann", "dune-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := lib.now.Add(14 * 24 * time.Hour); !loan.DueAt.Equal(want) || !loan.Active() {
+		t.Errorf("loan %+v, want an active loan due %v", loan, want)
+	}
+	if _, err := lib.Checkout("bob", "dune-1"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Checkout of a copy on loan = %v, want %v", err, ErrUnavailable)
+	}
+	if _, err := lib.Checkout("nobody", "dune-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Checkout by an unknown member = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := lib.Checkout("bob", "dune-9"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Checkout of an unknown copy = %v, want %v", err, ErrNotFound)
+	}
+
+	lib.days(3)
+	returned, err := lib.Return("dune-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returned.Active() || returned.Fine != 0 {
+		t.Errorf("returned loan %+v, want closed without a fine", returned)
+	}
+	if _, err := lib.Return("dune-1"); !errors.Is(err, ErrReturned) {
+		t.Errorf("Return twice = %v, want %v", err, ErrReturned)
+	}
+	if _, err := lib.Checkout("bob", "dune-1"); err != nil {
+		t.Errorf("Checkout of a returned copy: %v", err)
+	}
+}
+
+func TestAddCopyUnknownTitle(t *testing.T) {
+	lib := newTestLibrary(t, DefaultConfig())
+	if err := lib.AddCopy(Copy{ID: "x-1", Title: "Unknown"}); !errors.Is(err, book.ErrNotFound) {
+		t.Errorf("AddCopy of a book not in the catalogue = %v, want %v", err, book.ErrNotFound)
+	}
+}
+
+func TestLoanLimit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxLoans = 2
+	lib := newTestLibrary(t, cfg)
+
+	for _, id := range []string{"dune-1", "emma-1"} {
+		if _, err := lib.Checkout("ann", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := lib.Checkout("ann", "dune-2"); !errors.Is(err, ErrLoanLimit) {
+		t.Errorf("Checkout over the limit = %v, want %v", err, ErrLoanLimit)
+	}
+	if _, err := lib.Return("emma-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Checkout("ann", "dune-2"); err != nil {
+		t.Errorf("Checkout after a return: %v", err)
+	}
+}
+
+func TestFines(t *testing.T) {
+	lib := newTestLibrary(t, DefaultConfig())
+
+	if _, err := lib.Checkout("ann", "dune-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Checkout("ann", "emma-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// two days and an hour late: three started days
+	lib.days(16)
+	lib.now = lib.now.Add(time.Hour)
+	overdue, err := lib.Overdue()
+	if err != nil || len(overdue) != 2 {
+		t.Errorf("Overdue = %v, %v, want both loans", overdue, err)
+	}
+	if fines, err := lib.OutstandingFines("ann"); err != nil || fines != 2*75 {
+		t.Errorf("OutstandingFines while on loan = %d, %v, want %d", fines, err, 2*75)
+	}
+	loan, err := lib.Return("dune-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loan.Fine != 75 {
+		t.Errorf("fine %d, want 75", loan.Fine)
+	}
+
+	// the fine of a loan is capped
+	lib.days(100)
+	loan, err = lib.Return("emma-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loan.Fine != 1000 {
+		t.Errorf("fine %d, want the maximum of 1000", loan.Fine)
+	}
+
+	if _, err := lib.Checkout("ann", "dune-2"); !errors.Is(err, ErrFinesOutstanding) {
+		t.Errorf("Checkout owing 1075 = %v, want %v", err, ErrFinesOutstanding)
+	}
+	if err := lib.PayFines("ann"); err != nil {
+		t.Fatal(err)
+	}
+	if fines, err := lib.OutstandingFines("ann"); err != nil || fines != 0 {
+		t.Errorf("OutstandingFines after paying = %d, %v, want 0", fines, err)
+	}
+	if _, err := lib.Checkout("ann", "dune-2"); err != nil {
+		t.Errorf("Checkout after paying: %v", err)
+	}
+}
+
+func TestHolds(t *testing.T) {
+	lib := newTestLibrary(t, DefaultConfig())
+
+	if _, err := lib.Checkout("ann", "emma-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.PlaceHold("bob", "Emma"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.PlaceHold("bob", "Emma"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("PlaceHold twice = %v, want %v", err, ErrDuplicate)
+	}
+	if _, err := lib.PlaceHold("bob", "Unknown"); !errors.Is(err, book.ErrNotFound) {
+		t.Errorf("PlaceHold on an unknown title = %v, want %v", err, book.ErrNotFound)
+	}
+	cat, err := lib.PlaceHold("cat", "Emma")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the free copy goes to the first hold
+	if _, err := lib.Return("emma-1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []string{"ann", "cat"} {
+		if _, err := lib.Checkout(member, "emma-1"); !errors.Is(err, ErrReserved) {
+			t.Errorf("Checkout by %s before bob = %v, want %v", member, err, ErrReserved)
+		}
+	}
+	if _, err := lib.Checkout("bob", "emma-1"); err != nil {
+		t.Fatalf("Checkout by the first hold: %v", err)
+	}
+	if _, err := lib.Return("emma-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob's hold was used up, cat is next until the hold is cancelled
+	if _, err := lib.Checkout("ann", "emma-1"); !errors.Is(err, ErrReserved) {
+		t.Errorf("Checkout by ann before cat = %v, want %v", err, ErrReserved)
+	}
+	if err := lib.CancelHold(cat.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Checkout("ann", "emma-1"); err != nil {
+		t.Errorf("Checkout once no hold is left: %v", err)
+	}
+
+	// a hold only reserves as many copies as there are holds
+	if _, err := lib.Checkout("ann", "dune-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.PlaceHold("bob", "Dune"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Return("dune-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Checkout("cat", "dune-1"); err != nil {
+		t.Errorf("Checkout of one of two free copies with one hold: %v", err)
+	}
+}
+
+func TestZeroConfig(t *testing.T) {
+	lib := newTestLibrary(t, Config{})
+	loan, err := lib.Checkout("ann", "dune-1")
+	if err != nil {
+		t.Fatalf("Checkout with a zero Config: %v", err)
+	}
+	if want := lib.now.Add(DefaultConfig().LoanPeriod); !loan.DueAt.Equal(want) {
+		t.Errorf("due %v, want the default loan period", loan.DueAt)
+	}
+}
@@ -0,0 +1,173 @@
+package library
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Memory implements every storage the library needs in memory. It is
+// meant for tests and small programs, and is safe for concurrent use.
+type Memory struct {
+	mu       sync.Mutex
+	members  map[string]Member
+	copies   map[string]Copy
+	loans    []Loan
+	holds    []Hold
+	lastLoan int
+	lastHold int
+}
+
+func NewMemory() *Memory {
+	return &Memory{members: map[string]Member{}, copies: map[string]Copy{}}
+}
+
+func (m *Memory) AddMember(member Member) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[member.ID]; ok {
+		return fmt.Errorf("member %s: %w", member.ID, ErrDuplicate)
+	}
+	m.members[member.ID] = member
+	return nil
+}
+
+func (m *Memory) FindMember(id string) (*Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.members[id]
+	if !ok {
+		return nil, fmt.Errorf("member %s: %w", id, ErrNotFound)
+	}
+	return &member, nil
+}
+
+func (m *Memory) AddCopy(c Copy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.copies[c.ID]; ok {
+		return fmt.Errorf("copy %s: %w", c.ID, ErrDuplicate)
+	}
+	m.copies[c.ID] = c
+	return nil
+}
+
+func (m *Memory) FindCopy(id string) (*Copy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.copies[id]
+	if !ok {
+		return nil, fmt.Errorf("copy %s: %w", id, ErrNotFound)
+	}
+	return &c, nil
+}
+
+func (m *Memory) CopiesOf(title string) ([]Copy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []Copy{}
+	for _, c := range m.copies {
+		if c.Title == title {
+			result = append(result, c)
+		}
+	}
+	slices.SortFunc(result, func(a, b Copy) int { return strings.Compare(a.ID, b.ID) })
+	return result, nil
+}
+
+func (m *Memory) AddLoan(l *Loan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastLoan++
+	l.ID = m.lastLoan
+	m.loans = append(m.loans, *l)
+	return nil
+}
+
+func (m *Memory) UpdateLoan(l Loan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.loans, func(o Loan) bool { return o.ID == l.ID })
+	if i < 0 {
+		return fmt.Errorf("loan %d: %w", l.ID, ErrNotFound)
+	}
+	m.loans[i] = l
+	return nil
+}
+
+func (m *Memory) FindLoan(id int) (*Loan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.loans, func(o Loan) bool { return o.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("loan %d: %w", id, ErrNotFound)
+	}
+	l := m.loans[i]
+	return &l, nil
+}
+
+func (m *Memory) LoansOf(memberId string) ([]Loan, error) {
+	return m.filterLoans(func(l Loan) bool { return l.MemberID == memberId }), nil
+}
+
+func (m *Memory) ActiveLoans() ([]Loan, error) {
+	return m.filterLoans(Loan.Active), nil
+}
+
+func (m *Memory) filterLoans(match func(Loan) bool) []Loan {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []Loan{}
+	for _, l := range m.loans {
+		if match(l) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func (m *Memory) AddHold(h *Hold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastHold++
+	h.ID = m.lastHold
+	m.holds = append(m.holds, *h)
+	return nil
+}
+
+func (m *Memory) RemoveHold(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.holds, func(h Hold) bool { return h.ID == id })
+	if i < 0 {
+		return fmt.Errorf("hold %d: %w", id, ErrNotFound)
+	}
+	m.holds = slices.Delete(m.holds, i, i+1)
+	return nil
+}
+
+// HoldsOn keeps the order the holds were placed in
+func (m *Memory) HoldsOn(title string) ([]Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []Hold{}
+	for _, h := range m.holds {
+		if h.Title == title {
+			result = append(result, h)
+		}
+	}
+	return result, nil
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 
 	"dip/book"
+	"dip/di"
+	"dip/jsonstore"
+	"dip/kvstore"
 )
 
 func addBook1(b book.BookStorage) {
@@ -18,13 +23,53 @@ func findBook1(b book.BookStorage) *book.Book {
 	return b.FindBook("Harry Potter")
 }
 
+// newContainer registers how every dependency is built. Only the storage
+// provider depends on the configuration, nothing else has to change.
+func newContainer(storage, path string) (*di.Container, error) {
+	c := di.New()
+
+	var err error
+	switch storage {
+	case "memory":
+		err = di.Provide[book.BookStorageV2](c, di.Singleton, func() book.BookStorageV2 {
+			return book.NewBookSliceAdapter(&book.BookSlice{})
+		})
+	case "json":
+		err = di.Provide[book.BookStorageV2](c, di.Singleton, func() (*jsonstore.Store, error) {
+			return jsonstore.Open(path)
+		})
+	case "kv":
+		err = di.Provide[book.BookStorageV2](c, di.Singleton, func() (*kvstore.Store, error) {
+			return kvstore.Open(path)
+		})
+	default:
+		err = fmt.Errorf("unknown storage %q, want memory, json or kv", storage)
+	}
+
+	err = errors.Join(err,
+		di.Provide[book.BookStorage](c, di.Singleton, book.NewBookStorageAdapter),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return c, c.Validate()
+}
+
 func main() {
-	books := book.BookSlice{}
+	storage := flag.String("storage", "memory", "where to keep the books: memory, json or kv")
+	path := flag.String("path", "books.db", "file used by the json and kv storages")
+	flag.Parse()
+
+	c, err := newContainer(*storage, *path)
+	if err != nil {
+		panic(err)
+	}
+	books := di.MustResolve[book.BookStorage](c)
 
 	// pretending to use the interface
-	addBook1(&books)
-	addBook2(&books)
-	b := findBook1(&books)
+	addBook1(books)
+	addBook2(books)
+	b := findBook1(books)
 
 	fmt.Printf(b.Author)
 }
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	pathpkg "path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type options struct {
+	types        []string // every struct with validate tags when empty
+	shortCircuit bool     // stop at the first invalid value, like the first EmailBuilder
+}
+
+type builder struct {
+	Type         string
+	Name         string // of the builder
+	Var          string // of the value being built in the builder
+	ShortCircuit bool
+	Fields       []field
+}
+
+type field struct {
+	Name   string // of the struct field and its setter
+	Param  string
+	Type   string
+	Kind   kind
+	Label  string // in error messages
+	Checks []string
+	Zero   string // condition telling the field is unset, for required
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindNumber
+	kindBool
+	kindList // slices and maps
+	kindNilable
+	kindTime
+	kindOther
+)
+
+// generate returns the formatted source of the builders of the structs
+// of one file
+func generate(filename string, src []byte, opts options) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	var builders []builder
+	imports := map[string]bool{`"errors"`: true} // quoted, maybe named
+	found := map[string]bool{}
+	used := map[string]bool{} // package names in field types
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.TypeParams != nil {
+				continue
+			}
+			if len(opts.types) > 0 && !slices.Contains(opts.types, ts.Name.Name) {
+				continue
+			}
+			if len(opts.types) == 0 && !hasValidateTags(st) {
+				continue
+			}
+			found[ts.Name.Name] = true
+			b, err := newBuilder(fset, ts.Name.Name, st, opts, imports, used)
+			if err != nil {
+				return nil, err
+			}
+			builders = append(builders, b)
+		}
+	}
+	for _, name := range opts.types {
+		if !found[name] {
+			return nil, fmt.Errorf("%s: no struct type %s", filename, name)
+		}
+	}
+	if len(builders) == 0 {
+		return nil, fmt.Errorf("%s: no struct with validate tags", filename)
+	}
+
+	// the generated code refers to the types of the fields, and so to the
+	// packages the input file imports for them
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := pathpkg.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+			path = name + " " + strconv.Quote(path)
+		} else {
+			path = strconv.Quote(path)
+		}
+		if used[name] {
+			imports[path] = true
+		}
+	}
+
+	var b bytes.Buffer
+	err = fileTemplate.Execute(&b, map[string]any{
+		"Package":  f.Name.Name,
+		"Imports":  sortedKeys(imports),
+		"Builders": builders,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated code: %w\n%s", err, b.Bytes())
+	}
+	return out, nil
+}
+
+func hasValidateTags(st *ast.StructType) bool {
+	for _, f := range st.Fields.List {
+		if f.Tag != nil {
+			tag, _ := strconv.Unquote(f.Tag.Value)
+			if _, ok := reflect.StructTag(tag).Lookup("validate"); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newBuilder adds the names of the packages the field types refer to to used
+func newBuilder(fset *token.FileSet, name string, st *ast.StructType, opts options, imports, used map[string]bool) (builder, error) {
+	b := builder{Type: name, Name: name + "Builder", Var: lowerFirst(name), ShortCircuit: opts.shortCircuit}
+	if b.Var == "b" || token.IsKeyword(b.Var) {
+		b.Var = "value"
+	}
+
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(s)
+		}
+		if tag.Get("builder") == "-" {
+			continue
+		}
+		if len(f.Names) == 0 {
+			return b, fmt.Errorf("%s: embedded fields are not supported, tag them `builder:\"-\"`", fset.Position(f.Pos()))
+		}
+
+		typ := exprString(fset, f.Type)
+		ast.Inspect(f.Type, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok {
+					used[pkg.Name] = true
+				}
+			}
+			return true
+		})
+		for _, ident := range f.Names {
+			fd := field{
+				Name:  ident.Name,
+				Param: lowerFirst(ident.Name),
+				Type:  typ,
+				Kind:  kindOf(f.Type),
+				Label: lowerFirst(ident.Name),
+			}
+			setter := upperFirst(ident.Name)
+			if slices.Contains([]string{"Build", "Reset"}, setter) {
+				return b, fmt.Errorf("%s: field %s clashes with the %s method of the builder", fset.Position(ident.Pos()), ident.Name, setter)
+			}
+			if token.IsKeyword(fd.Param) || fd.Param == "b" || fd.Param == b.Var {
+				fd.Param = "v"
+			}
+			if err := fd.parseTag(tag.Get("validate"), imports); err != nil {
+				return b, fmt.Errorf("%s: %s: %w", fset.Position(ident.Pos()), ident.Name, err)
+			}
+			b.Fields = append(b.Fields, fd)
+		}
+	}
+	return b, nil
+}
+
+// parseTag turns `validate:"required,max=10"` into checks. The rules are:
+//
+//	required   the field must be set before Build
+//	min=N      the least length of a string, slice or map, or value of a number
+//	max=N      the greatest one
+//	email      an RFC 5322 address, for strings
+//	oneof=a b  one of the values, for strings
+func (f *field) parseTag(tag string, imports map[string]bool) error {
+	if tag == "" {
+		return nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(rule), "=")
+		switch {
+		case name == "required" && !hasArg:
+			zero, err := f.zero()
+			if err != nil {
+				return err
+			}
+			f.Zero = zero
+		case (name == "min" || name == "max") && hasArg:
+			if err := f.bound(name, arg, imports); err != nil {
+				return err
+			}
+		case name == "email" && !hasArg && f.Kind == kindString:
+			imports[`"fmt"`], imports[`"net/mail"`] = true, true
+			f.Checks = append(f.Checks, fmt.Sprintf(
+				"if _, err := mail.ParseAddress(%s); err != nil {\nreturn b.fail(%q, fmt.Errorf(\"%s: %%q is not a valid address: %%v\", %s, err))\n}",
+				f.Param, f.Label, f.Label, f.Param))
+		case name == "oneof" && hasArg && f.Kind == kindString:
+			imports[`"fmt"`], imports[`"slices"`] = true, true
+			values := strings.Fields(arg)
+			quoted := make([]string, len(values))
+			for i, v := range values {
+				quoted[i] = strconv.Quote(v)
+			}
+			f.Checks = append(f.Checks, fmt.Sprintf(
+				"if !slices.Contains([]string{%s}, %s) {\nreturn b.fail(%q, fmt.Errorf(\"%s: %%q is not one of %s\", %s))\n}",
+				strings.Join(quoted, ", "), f.Param, f.Label, f.Label, strings.Join(values, ", "), f.Param))
+		default:
+			return fmt.Errorf("unsupported validate rule %q for %s", rule, f.Type)
+		}
+	}
+	return nil
+}
+
+func (f *field) bound(name, arg string, imports map[string]bool) error {
+	op, word := "<", "must be at least"
+	if name == "max" {
+		op, word = ">", "must be at most"
+	}
+	var value, unit string
+	switch f.Kind {
+	case kindString:
+		imports[`"unicode/utf8"`] = true
+		value, unit = fmt.Sprintf("utf8.RuneCountInString(%s)", f.Param), " characters"
+	case kindList:
+		value, word = fmt.Sprintf("len(%s)", f.Param), "length "+word
+	case kindNumber:
+		value = f.Param
+	default:
+		return fmt.Errorf("%s does not apply to %s", name, f.Type)
+	}
+	if _, err := strconv.ParseFloat(arg, 64); err != nil {
+		return fmt.Errorf("%s=%s is not a number", name, arg)
+	}
+	f.Checks = append(f.Checks, fmt.Sprintf(
+		"if %s %s %s {\nreturn b.fail(%q, errors.New(\"%s: %s %s%s\"))\n}",
+		value, op, arg, f.Label, f.Label, word, arg, unit))
+	return nil
+}
+
+func (f *field) zero() (string, error) {
+	v := "v." + f.Name
+	switch f.Kind {
+	case kindString:
+		return v + ` == ""`, nil
+	case kindNumber:
+		return v + " == 0", nil
+	case kindList:
+		return "len(" + v + ") == 0", nil
+	case kindNilable:
+		return v + " == nil", nil
+	case kindTime:
+		return v + ".IsZero()", nil
+	}
+	return "", fmt.Errorf("required does not apply to %s", f.Type)
+}
+
+// kindOf only looks at the syntax, named types other than the predeclared
+// ones and time.Time cannot be validated
+func kindOf(expr ast.Expr) kind {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return kindString
+		case "bool":
+			return kindBool
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+			"float32", "float64", "byte", "rune", "uintptr":
+			return kindNumber
+		}
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return kindList
+		}
+	case *ast.MapType:
+		return kindList
+	case *ast.StarExpr, *ast.InterfaceType, *ast.FuncType, *ast.ChanType:
+		return kindNilable
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" {
+			switch t.Sel.Name {
+			case "Time":
+				return kindTime
+			case "Duration":
+				return kindNumber
+			}
+		}
+	}
+	return kindOther
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var b bytes.Buffer
+	format.Node(&b, fset, expr)
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	// keep acronyms readable: ID becomes id, URLPath becomes urlPath
+	i := 0
+	for i < len(r) && unicode.IsUpper(r[i]) && (i == 0 || i+1 == len(r) || unicode.IsUpper(r[i+1])) {
+		r[i] = unicode.ToLower(r[i])
+		i++
+	}
+	return string(r)
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+var fileTemplate = template.Must(template.New("").Funcs(template.FuncMap{"upper": upperFirst}).Parse(`// Code generated by buildergen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range .Builders}}{{$b := .}}
+// {{.Name}} builds {{.Type}} values step by step, validating every value
+{{if .ShortCircuit -}}
+// as it is set. Once a value is invalid the following ones are ignored
+// and Build reports it. The zero value is ready to use.
+{{- else -}}
+// as it is set. It keeps going past invalid values, so Build reports every
+// problem at once. The zero value is ready to use.
+{{- end}}
+type {{.Name}} struct {
+	err    error
+	failed map[string]bool // fields given an invalid value
+	{{.Var}} *{{.Type}}
+}
+
+func (b *{{.Name}}) Build() (*{{.Type}}, error) {
+	{{- if .ShortCircuit}}
+	if b.err != nil {
+		return nil, b.err
+	}
+	{{- end}}
+	// the builder may go on changing its own copy
+	v := *b.current()
+	err := b.err
+	{{- range .Fields}}{{if .Zero}}
+	if {{.Zero}} && !b.failed[{{printf "%q" .Label}}] {
+		err = errors.Join(err, errors.New({{printf "%q" (print .Label " is required")}}))
+	}
+	{{- end}}{{end}}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (b *{{.Name}}) Reset() *{{.Name}} {
+	b.err = nil
+	b.failed = nil
+	b.{{.Var}} = &{{.Type}}{}
+	return b
+}
+{{range .Fields}}
+func (b *{{$b.Name}}) {{upper .Name}}({{.Param}} {{.Type}}) *{{$b.Name}} {
+	{{- if $b.ShortCircuit}}
+	if b.err != nil {
+		return b
+	}
+	{{- end}}
+	{{- range .Checks}}
+	{{.}}
+	{{- end}}
+	b.current().{{.Name}} = {{.Param}}
+	return b
+}
+{{end}}
+func (b *{{.Name}}) current() *{{.Type}} {
+	if b.{{.Var}} == nil {
+		b.{{.Var}} = &{{.Type}}{}
+	}
+	return b.{{.Var}}
+}
+
+// fail records a problem with a field, Build reports {{if .ShortCircuit}}it{{else}}all of them{{end}}
+func (b *{{.Name}}) fail(field string, err error) *{{.Name}} {
+	if b.failed == nil {
+		b.failed = map[string]bool{}
+	}
+	b.failed[field] = true
+	b.err = errors.Join(b.err, err)
+	return b
+}
+{{end}}`))
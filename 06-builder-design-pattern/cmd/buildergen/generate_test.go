@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestGolden generates the builders of every testdata/*.go file with the
+// options of its "//go:generate buildergen ..." line and compares them
+// with testdata/*.golden
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no .go files in testdata")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := directive(src)
+			if err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			got, err := generate(file, src, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenFile := strings.TrimSuffix(file, ".go") + ".golden"
+			if *update {
+				if err := os.WriteFile(goldenFile, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("the generated code differs from %s, run go test -update if the change is intended\n%s", goldenFile, got)
+			}
+		})
+	}
+}
+
+// directive reads the options of the first //go:generate buildergen line
+func directive(src []byte) (options, error) {
+	s := bufio.NewScanner(bytes.NewReader(src))
+	for s.Scan() {
+		args := strings.Fields(s.Text())
+		if len(args) < 2 || args[0] != "//go:generate" || args[1] != "buildergen" {
+			continue
+		}
+		fs := flag.NewFlagSet("directive", flag.ContinueOnError)
+		types := fs.String("type", "", "")
+		shortCircuit := fs.Bool("shortcircuit", false, "")
+		if err := fs.Parse(args[2:]); err != nil {
+			return options{}, err
+		}
+		opts := options{shortCircuit: *shortCircuit}
+		if *types != "" {
+			opts.types = strings.Split(*types, ",")
+		}
+		return opts, nil
+	}
+	return options{}, errors.New("no //go:generate buildergen line")
+}
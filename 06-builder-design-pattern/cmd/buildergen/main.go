@@ -0,0 +1,61 @@
+// Command buildergen generates validating fluent builders like EmailBuilder
+// for the structs of a file, from their validate tags (see generate.go).
+// It is meant for go generate:
+//
+//	//go:generate go run ./cmd/buildergen -type Contact
+//
+// writes contact_builder.go next to the file holding the directive. Every
+// testdata/*.go file holds such a directive and its expected output in
+// a .golden file, go test checks them and go test -update rewrites them.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "buildergen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("buildergen", flag.ContinueOnError)
+	types := fs.String("type", "", "comma separated struct names; every struct with validate tags when empty")
+	input := fs.String("input", os.Getenv("GOFILE"), "file declaring the structs, $GOFILE under go generate")
+	output := fs.String("output", "", "file to write, the input name with a _builder suffix by default")
+	shortCircuit := fs.Bool("shortcircuit", false, "ignore the values set after an invalid one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *input == "" {
+		return errors.New("no input file, run it with go generate or give -input")
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(*input, ".go") + "_builder.go"
+		if *types != "" && !strings.Contains(*types, ",") {
+			*output = filepath.Join(filepath.Dir(*input), strings.ToLower(*types)+"_builder.go")
+		}
+	}
+
+	src, err := os.ReadFile(*input)
+	if err != nil {
+		return err
+	}
+	opts := options{shortCircuit: *shortCircuit}
+	if *types != "" {
+		opts.types = strings.Split(*types, ",")
+	}
+	out, err := generate(*input, src, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*output, out, 0o644)
+}
@@ -0,0 +1,17 @@
+package testdata
+
+//go:generate buildergen
+
+type Contact struct {
+	Name     string   `validate:"required,max=100"`
+	Email    string   `validate:"required,email"`
+	Language string   `validate:"oneof=en de fr"`
+	Tags     []string `validate:"max=10"`
+	Age      int      `validate:"min=0,max=150"`
+	Notes    string
+}
+
+// no validate tags, no builder
+type ignored struct {
+	value int
+}
@@ -0,0 +1,25 @@
+package testdata
+
+import "time"
+
+//go:generate buildergen -type Order,Line -shortcircuit
+
+type Order struct {
+	ID       string            `validate:"required"`
+	Type     string            `validate:"oneof=retail wholesale"`
+	Lines    []Line            `validate:"required,min=1"`
+	Meta     map[string]string `validate:"max=20"`
+	Customer *Contact          `validate:"required"`
+	PlacedAt time.Time         `validate:"required"`
+	Timeout  time.Duration     `validate:"max=3600000000000"`
+	Paid     bool
+	internal int `builder:"-"`
+}
+
+type Line struct {
+	SKU      string  `validate:"required,min=3,max=12"`
+	Quantity int     `validate:"required,min=1"`
+	Price    float64 `validate:"min=0"`
+}
+
+type Contact struct{}
@@ -0,0 +1,19 @@
+package main
+
+import "net/mail"
+
+//go:generate go run ./cmd/buildergen -type Contact
+
+// Contact is someone on a mailing list. Its builder, ContactBuilder, is
+// generated from the validate tags.
+type Contact struct {
+	Name     string   `validate:"required,max=100"`
+	Email    string   `validate:"required,email"`
+	Language string   `validate:"oneof=en de fr"`
+	Topics   []string `validate:"max=10"`
+}
+
+// Address is what To, Cc and Bcc accept
+func (c Contact) Address() string {
+	return (&mail.Address{Name: c.Name, Address: c.Email}).String()
+}
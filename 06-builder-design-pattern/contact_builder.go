@@ -0,0 +1,92 @@
+// Code generated by buildergen. DO NOT EDIT.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"unicode/utf8"
+)
+
+// ContactBuilder builds Contact values step by step, validating every value
+// as it is set. It keeps going past invalid values, so Build reports every
+// problem at once. The zero value is ready to use.
+type ContactBuilder struct {
+	err     error
+	failed  map[string]bool // fields given an invalid value
+	contact *Contact
+}
+
+func (b *ContactBuilder) Build() (*Contact, error) {
+	// the builder may go on changing its own copy
+	v := *b.current()
+	err := b.err
+	if v.Name == "" && !b.failed["name"] {
+		err = errors.Join(err, errors.New("name is required"))
+	}
+	if v.Email == "" && !b.failed["email"] {
+		err = errors.Join(err, errors.New("email is required"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (b *ContactBuilder) Reset() *ContactBuilder {
+	b.err = nil
+	b.failed = nil
+	b.contact = &Contact{}
+	return b
+}
+
+func (b *ContactBuilder) Name(name string) *ContactBuilder {
+	if utf8.RuneCountInString(name) > 100 {
+		return b.fail("name", errors.New("name: must be at most 100 characters"))
+	}
+	b.current().Name = name
+	return b
+}
+
+func (b *ContactBuilder) Email(email string) *ContactBuilder {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return b.fail("email", fmt.Errorf("email: %q is not a valid address: %v", email, err))
+	}
+	b.current().Email = email
+	return b
+}
+
+func (b *ContactBuilder) Language(language string) *ContactBuilder {
+	if !slices.Contains([]string{"en", "de", "fr"}, language) {
+		return b.fail("language", fmt.Errorf("language: %q is not one of en, de, fr", language))
+	}
+	b.current().Language = language
+	return b
+}
+
+func (b *ContactBuilder) Topics(topics []string) *ContactBuilder {
+	if len(topics) > 10 {
+		return b.fail("topics", errors.New("topics: length must be at most 10"))
+	}
+	b.current().Topics = topics
+	return b
+}
+
+func (b *ContactBuilder) current() *Contact {
+	if b.contact == nil {
+		b.contact = &Contact{}
+	}
+	return b.contact
+}
+
+// fail records a problem with a field, Build reports all of them
+func (b *ContactBuilder) fail(field string, err error) *ContactBuilder {
+	if b.failed == nil {
+		b.failed = map[string]bool{}
+	}
+	b.failed[field] = true
+	b.err = errors.Join(b.err, err)
+	return b
+}
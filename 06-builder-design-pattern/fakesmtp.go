@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeSMTPServer is a small SMTP server that keeps every message it
+// receives in memory, so mail can really be delivered in tests and demos
+// without a relay. It offers AUTH PLAIN when Username is set and STARTTLS
+// when TLSConfig is set, and then requires them.
+type FakeSMTPServer struct {
+	Username  string
+	Password  string
+	TLSConfig *tls.Config
+
+	// CloseTimeout is how long Close lets open connections finish, 5s when
+	// zero
+	CloseTimeout time.Duration
+
+	ln       net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	deadline time.Time // set by Close
+	messages []SentMessage
+}
+
+// Start listens on a free port of the loopback interface
+func (s *FakeSMTPServer) Start() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	s.conns = map[net.Conn]bool{}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = true
+			if !s.deadline.IsZero() {
+				conn.SetDeadline(s.deadline)
+			}
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.forget(conn)
+				s.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+func (s *FakeSMTPServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stops accepting connections and waits for the open ones to end.
+// Connections still open after CloseTimeout are closed.
+func (s *FakeSMTPServer) Close() error {
+	err := s.ln.Close()
+
+	timeout := s.CloseTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	// a deadline ends the sessions blocked reading from an idle client
+	s.mu.Lock()
+	s.deadline = time.Now().Add(timeout)
+	for conn := range s.conns {
+		conn.SetDeadline(s.deadline)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *FakeSMTPServer) forget(conn net.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+func (s *FakeSMTPServer) Messages() []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentMessage{}, s.messages...)
+}
+
+// session is the state of one connection
+type session struct {
+	tp      *textproto.Conn
+	tls     bool
+	authed  bool
+	from    string
+	to      []string
+	started bool // MAIL FROM was accepted
+}
+
+func (s *FakeSMTPServer) serve(conn net.Conn) {
+	ss := &session{tp: textproto.NewConn(conn)}
+	ss.tp.PrintfLine("220 localhost fake ESMTP ready")
+
+	for {
+		line, err := ss.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			ss.tp.PrintfLine("250 localhost")
+		case "EHLO":
+			ext := []string{"localhost", "8BITMIME"}
+			if s.TLSConfig != nil && !ss.tls {
+				ext = append(ext, "STARTTLS")
+			}
+			if s.Username != "" {
+				ext = append(ext, "AUTH PLAIN")
+			}
+			for i, e := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				ss.tp.PrintfLine("250%s%s", sep, e)
+			}
+		case "STARTTLS":
+			if s.TLSConfig == nil || ss.tls {
+				ss.tp.PrintfLine("502 STARTTLS not available")
+				continue
+			}
+			ss.tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			// the client starts over with EHLO
+			ss = &session{tp: textproto.NewConn(tlsConn), tls: true}
+		case "AUTH":
+			ss.authed = s.auth(ss, arg)
+		case "MAIL":
+			switch {
+			case s.TLSConfig != nil && !ss.tls:
+				ss.tp.PrintfLine("530 must issue STARTTLS first")
+			case s.Username != "" && !ss.authed:
+				ss.tp.PrintfLine("530 authentication required")
+			default:
+				ss.from, ss.to, ss.started = pathOf(arg), nil, true
+				ss.tp.PrintfLine("250 OK")
+			}
+		case "RCPT":
+			if !ss.started {
+				ss.tp.PrintfLine("503 need MAIL first")
+				continue
+			}
+			ss.to = append(ss.to, pathOf(arg))
+			ss.tp.PrintfLine("250 OK")
+		case "DATA":
+			if len(ss.to) == 0 {
+				ss.tp.PrintfLine("503 need RCPT first")
+				continue
+			}
+			ss.tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := readData(ss.tp)
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, SentMessage{From: ss.from, To: ss.to, Data: data})
+			s.mu.Unlock()
+			ss.from, ss.to, ss.started = "", nil, false
+			ss.tp.PrintfLine("250 OK queued")
+		case "RSET":
+			ss.from, ss.to, ss.started = "", nil, false
+			ss.tp.PrintfLine("250 OK")
+		case "NOOP":
+			ss.tp.PrintfLine("250 OK")
+		case "QUIT":
+			ss.tp.PrintfLine("221 bye")
+			return
+		default:
+			ss.tp.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// auth handles AUTH PLAIN, with or without an initial response
+func (s *FakeSMTPServer) auth(ss *session, arg string) bool {
+	mechanism, response, _ := strings.Cut(arg, " ")
+	if s.Username == "" || !strings.EqualFold(mechanism, "PLAIN") {
+		ss.tp.PrintfLine("504 unrecognized authentication type")
+		return false
+	}
+	if response == "" {
+		ss.tp.PrintfLine("334 ")
+		line, err := ss.tp.ReadLine()
+		if err != nil {
+			return false
+		}
+		response = line
+	}
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	parts := bytes.Split(decoded, []byte{0})
+	if err != nil || len(parts) != 3 || string(parts[1]) != s.Username || string(parts[2]) != s.Password {
+		ss.tp.PrintfLine("535 authentication failed")
+		return false
+	}
+	ss.tp.PrintfLine("235 authentication succeeded")
+	return true
+}
+
+// pathOf extracts the address of "FROM:<a@b.c> SIZE=100"
+func pathOf(arg string) string {
+	start, end := strings.IndexByte(arg, '<'), strings.IndexByte(arg, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+// readData reads up to the lone dot, undoing the dot stuffing and keeping
+// the CRLF line endings
+func readData(tp *textproto.Conn) ([]byte, error) {
+	var b bytes.Buffer
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "." {
+			return b.Bytes(), nil
+		}
+		b.WriteString(strings.TrimPrefix(line, "."))
+		b.WriteString("\r\n")
+	}
+}
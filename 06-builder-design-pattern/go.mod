@@ -0,0 +1,3 @@
+module builder
+
+go 1.22.0
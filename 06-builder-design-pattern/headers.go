@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidHeader = errors.New("invalid header")
+
+type header struct {
+	name, value string
+}
+
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityLow
+)
+
+// headers sets the X-Priority and Importance headers most clients
+// understand, a normal priority sets none
+func (p Priority) headers() []header {
+	switch p {
+	case PriorityHigh:
+		return []header{{"X-Priority", "1 (Highest)"}, {"Importance", "high"}}
+	case PriorityLow:
+		return []header{{"X-Priority", "5 (Lowest)"}, {"Importance", "low"}}
+	}
+	return nil
+}
+
+// reserved headers are set by the builder, a custom header cannot
+// replace them
+var reserved = []string{
+	"From", "To", "Cc", "Bcc", "Reply-To", "Subject", "Date", "Message-Id",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+	"Content-Disposition", "Content-Id",
+	"X-Priority", "Importance",
+}
+
+// Header adds a custom header. The same name may be added more than once.
+func (eb *EmailBuilder) Header(name, value string) *EmailBuilder {
+	canonical := textproto.CanonicalMIMEHeaderKey(name)
+	switch {
+	case !validHeaderName(name):
+		return eb.fail("header", fmt.Errorf("%w: %q is not a valid name", ErrInvalidHeader, name))
+	case slices.Contains(reserved, canonical):
+		return eb.fail("header", fmt.Errorf("%w: %s is set by the builder", ErrInvalidHeader, name))
+	case strings.ContainsAny(value, "\r\n"):
+		return eb.fail("header", fmt.Errorf("%w: %s: line breaks are not allowed", ErrInvalidHeader, name))
+	case strings.ContainsFunc(value, unicode.IsControl):
+		return eb.fail("header", fmt.Errorf("%w: %s: control characters are not allowed", ErrInvalidHeader, name))
+	}
+	eb.current().headers = append(eb.current().headers, header{canonical, value})
+	return eb
+}
+
+func (eb *EmailBuilder) Priority(p Priority) *EmailBuilder {
+	if p < PriorityNormal || p > PriorityLow {
+		return eb.fail("priority", fmt.Errorf("unknown priority %d", p))
+	}
+	eb.current().priority = p
+	return eb
+}
+
+// validHeaderName allows the printable ASCII characters but the colon
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if c <= ' ' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"embed"
 	"errors"
+	"flag"
 	"fmt"
+	"maps"
+	"net/mail"
+	"slices"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // only give access to email behaviour
@@ -13,79 +21,215 @@ type Email interface {
 
 // hide all properties from user
 type email struct {
-	from, to, subject, message string
+	from             *mail.Address
+	to, cc, bcc      []*mail.Address
+	replyTo          []*mail.Address
+	subject, message string
+	html             string
+	attachments      []attachment
+	template         *templateCall // rendered by Build
+	headers          []header      // custom ones, in the order they were added
+	priority         Priority
+
+	// set by Build
+	date      time.Time
+	messageId string
+
+	transport Transport
 }
 
-func (e email) Send() error {
-	// todo: send the email
-	return nil
+func (e *email) Send() error {
+	if e.transport == nil {
+		return ErrNoTransport
+	}
+	return e.transport.Send(e.from.Address, e.recipients(), e.render())
+}
+
+// recipients is the envelope: every To, Cc and Bcc address, once
+func (e *email) recipients() []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, list := range [][]*mail.Address{e.to, e.cc, e.bcc} {
+		for _, addr := range list {
+			if key := strings.ToLower(addr.Address); !seen[key] {
+				seen[key] = true
+				result = append(result, addr.Address)
+			}
+		}
+	}
+	return result
 }
 
+var (
+	ErrInvalidAddress = errors.New("invalid address")
+	ErrInvalidSubject = errors.New("invalid subject")
+	ErrInvalidMessage = errors.New("invalid message")
+	ErrMissing        = errors.New("missing")
+)
+
+// maxSubjectLength keeps the subject readable. It does not bound the
+// length of the header, a non-ASCII subject is encoded into several times
+// as many characters, folded on as many lines as needed (see
+// encodeSubject).
+const maxSubjectLength = 255
+
+// EmailBuilder validates every value as it is set but keeps going, so
+// Build reports every problem at once. The zero value is ready to use.
 type EmailBuilder struct {
-	err   error
-	email *email
+	err    error
+	failed map[string]bool // fields given an invalid value
+	email  *email
 }
 
 func (eb *EmailBuilder) Build() (Email, error) {
-	if eb.err != nil {
-		return nil, eb.err
-	}
+	// the builder may go on changing its own copy
+	e := *eb.current()
+	err := eb.err
+	failed := map[string]bool{}
+	maps.Copy(failed, eb.failed)
 
-	valid := eb.err != nil && len(eb.email.from) > 0 && len(eb.email.to) > 0 &&
-		len(eb.email.subject) > 0 && len(eb.email.message) > 0
+	if t := e.template; t != nil {
+		subject, text, html, renderErr := t.templates.render(t.name, t.data)
+		if renderErr == nil {
+			renderErr = checkSubject(subject)
+		}
+		if renderErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", t.name, renderErr))
+			failed["subject"], failed["message"] = true, true
+		}
+		e.subject, e.message, e.html = subject, text, html
+	}
 
-	if !valid {
-		eb.err = errors.New("an email must have from, to, subject and message")
-		return nil, eb.err
+	missing := func(field string, unset bool) {
+		if unset && !failed[field] {
+			err = errors.Join(err, fmt.Errorf("%w: %s", ErrMissing, field))
+		}
+	}
+	missing("from", e.from == nil)
+	missing("to", len(e.to)+len(e.cc)+len(e.bcc) == 0)
+	missing("subject", e.subject == "")
+	missing("message", e.message == "" && e.html == "")
+	// only an HTML body can show inline images
+	if e.html == "" && !failed["message"] && slices.ContainsFunc(e.attachments, func(a attachment) bool { return a.inline }) {
+		err = errors.Join(err, fmt.Errorf("%w: inline attachments need an HTML body", ErrInvalidMessage))
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return eb.email, nil
+	e.to = slices.Clone(e.to)
+	e.cc = slices.Clone(e.cc)
+	e.bcc = slices.Clone(e.bcc)
+	e.replyTo = slices.Clone(e.replyTo)
+	e.headers = slices.Clone(e.headers)
+	e.attachments = slices.Clone(e.attachments)
+	e.date = time.Now()
+	e.messageId = newMessageId(e.from.Address)
+	return &e, nil
 }
 
+// From accepts an RFC 5322 address, with or without a display name:
+// "foo@test.com" or "Foo <foo@test.com>"
 func (eb *EmailBuilder) From(from string) *EmailBuilder {
-	if eb.err != nil {
-		return eb
-	}
-	// validation
-	if !strings.Contains(from, "@") {
-		eb.err = errors.New("an email address should have '@'")
-		return eb
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return eb.fail("from", fmt.Errorf("%w: from %q: %v", ErrInvalidAddress, from, err))
 	}
-
-	eb.email.from = from
+	eb.current().from = addr
 	return eb
 }
 
 func (eb *EmailBuilder) Message(message string) *EmailBuilder {
-	if eb.err != nil {
-		return eb
+	if !utf8.ValidString(message) {
+		return eb.fail("message", fmt.Errorf("%w: not UTF-8", ErrInvalidMessage))
 	}
-	// todo: validation
-	eb.email.message = message
+	eb.current().message = message
 	return eb
 }
 
 func (eb *EmailBuilder) Reset() *EmailBuilder {
 	eb.err = nil
+	eb.failed = nil
 	eb.email = &email{}
 	return eb
 }
 
+// Subject must fit on one line: a line break would let it inject headers
 func (eb *EmailBuilder) Subject(subject string) *EmailBuilder {
-	if eb.err != nil {
-		return eb
+	if err := checkSubject(subject); err != nil {
+		return eb.fail("subject", err)
+	}
+	eb.current().subject = subject
+	return eb
+}
+
+func checkSubject(subject string) error {
+	switch {
+	case strings.ContainsAny(subject, "\r\n"):
+		return fmt.Errorf("%w: line breaks are not allowed", ErrInvalidSubject)
+	case strings.ContainsFunc(subject, unicode.IsControl):
+		return fmt.Errorf("%w: control characters are not allowed", ErrInvalidSubject)
+	case !utf8.ValidString(subject):
+		return fmt.Errorf("%w: not UTF-8", ErrInvalidSubject)
+	case utf8.RuneCountInString(subject) > maxSubjectLength:
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidSubject, maxSubjectLength)
+	}
+	return nil
+}
+
+// Transport is how the email will be sent
+func (eb *EmailBuilder) Transport(t Transport) *EmailBuilder {
+	eb.current().transport = t
+	return eb
+}
+
+// To adds recipients. Every argument may be a single address like From
+// accepts, or a comma separated list of them.
+func (eb *EmailBuilder) To(to ...string) *EmailBuilder {
+	return eb.addresses("to", &eb.current().to, to)
+}
+
+// Cc adds recipients like To does
+func (eb *EmailBuilder) Cc(cc ...string) *EmailBuilder {
+	return eb.addresses("cc", &eb.current().cc, cc)
+}
+
+// Bcc adds recipients that get the email without appearing in any header
+func (eb *EmailBuilder) Bcc(bcc ...string) *EmailBuilder {
+	return eb.addresses("bcc", &eb.current().bcc, bcc)
+}
+
+// ReplyTo adds the addresses replies should go to instead of From
+func (eb *EmailBuilder) ReplyTo(replyTo ...string) *EmailBuilder {
+	return eb.addresses("reply-to", &eb.current().replyTo, replyTo)
+}
+
+func (eb *EmailBuilder) addresses(field string, list *[]*mail.Address, values []string) *EmailBuilder {
+	for _, value := range values {
+		addrs, err := mail.ParseAddressList(value)
+		if err != nil {
+			eb.fail(field, fmt.Errorf("%w: %s %q: %v", ErrInvalidAddress, field, value, err))
+			continue
+		}
+		*list = append(*list, addrs...)
 	}
-	// todo: validation
-	eb.email.subject = subject
 	return eb
 }
 
-func (eb *EmailBuilder) To(to string) *EmailBuilder {
-	if eb.err != nil {
-		return eb
+func (eb *EmailBuilder) current() *email {
+	if eb.email == nil {
+		eb.email = &email{}
 	}
-	// todo: validation
-	eb.email.to = to
+	return eb.email
+}
+
+// fail records a problem with a field, Build reports all of them
+func (eb *EmailBuilder) fail(field string, err error) *EmailBuilder {
+	if eb.failed == nil {
+		eb.failed = map[string]bool{}
+	}
+	eb.failed[field] = true
+	eb.err = errors.Join(eb.err, err)
 	return eb
 }
 
@@ -98,8 +242,8 @@ func sendMail(from, to, subject, message string) error {
 
 	// initialization steps
 	e := email{}
-	e.from = from
-	e.to = to
+	e.from = &mail.Address{Address: from}
+	e.to = []*mail.Address{{Address: to}}
 	e.subject = subject
 	e.message = message
 
@@ -108,21 +252,94 @@ func sendMail(from, to, subject, message string) error {
 	return nil
 }
 
+//go:embed templates
+var templateFiles embed.FS
+
 func main() {
+	addr := flag.String("smtp", "", "SMTP server to send through, host:port; an in-memory server when empty")
+	user := flag.String("user", "", "SMTP username")
+	password := flag.String("password", "", "SMTP password")
+	outboxDir := flag.String("outbox", "", "queue the email in this directory and send it in the background")
+	flag.Parse()
+
+	var fake *FakeSMTPServer
+	if *addr == "" {
+		fake = &FakeSMTPServer{}
+		if err := fake.Start(); err != nil {
+			panic(err)
+		}
+		defer fake.Close()
+		*addr = fake.Addr()
+	}
+	transport := NewSMTPTransport(*addr)
+	transport.Username, transport.Password = *user, *password
+
+	templates, err := LoadTemplates(templateFiles, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+
 	eb := EmailBuilder{}
 
 	// method chaining
 	email, err := eb.
-		From("foo.com").
-		To("bar@test.com").
-		Subject("Greeting").
-		Message("Hello world!").
+		From("Foo <foo@test.com>").
+		To("bar@test.com", "Baz <baz@test.com>").
+		Bcc("archive@test.com").
+		Template(templates, "greeting", map[string]string{"Name": "Bar"}).
+		Transport(transport).
 		Build()
 
 	if err != nil {
 		panic(err)
 	}
 
-	email.Send()
+	if *outboxDir == "" {
+		if err := email.Send(); err != nil {
+			panic(err)
+		}
+	} else if err := sendThroughOutbox(*outboxDir, transport, email); err != nil {
+		panic(err)
+	}
 	fmt.Println("Email sent successfully!")
+
+	if fake != nil {
+		for _, m := range fake.Messages() {
+			fmt.Printf("\n%s -> %s\n%s", m.From, strings.Join(m.To, ", "), m.Data)
+		}
+	}
+}
+
+// sendThroughOutbox queues the email and waits until the outbox is done with it
+func sendThroughOutbox(dir string, t Transport, e Email) error {
+	outbox, err := NewOutbox(DefaultOutboxConfig(dir, t))
+	if err != nil {
+		return err
+	}
+	outbox.Start()
+	defer outbox.Close()
+
+	id, err := outbox.Enqueue(e)
+	if err != nil {
+		return err
+	}
+	for {
+		status, err := outbox.Status(id)
+		if err != nil {
+			return err
+		}
+		switch status.State {
+		case StateSent:
+			return nil
+		case StateDead:
+			var errs []error
+			for _, d := range status.Deliveries {
+				if d.State == StateDead {
+					errs = append(errs, fmt.Errorf("%s: %s: %s", id, d.Domain, d.LastError))
+				}
+			}
+			return errors.Join(errs...)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// valid sets every required field, the cases then break one of them
+func valid() *EmailBuilder {
+	return (&EmailBuilder{}).From("foo@test.com").To("bar@test.com").Subject("Hello").Message("Hello")
+}
+
+func TestBuild(t *testing.T) {
+	e, err := (&EmailBuilder{}).
+		From("Foo <foo@test.com>").
+		To("bar@test.com, Baz <baz@test.com>").
+		Subject("Hello").
+		Message("Hello").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := e.(*email)
+	if em.from.Name != "Foo" || len(em.to) != 2 || em.to[1].Name != "Baz" {
+		t.Errorf("built from %v to %v, want the display names kept", em.from, em.to)
+	}
+	if em.date.IsZero() || !strings.HasSuffix(em.messageId, "@test.com>") {
+		t.Errorf("built with date %v and Message-ID %s, want both set in test.com", em.date, em.messageId)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		build *EmailBuilder
+		want  error
+	}{
+		{"from", valid().From("foo.com"), ErrInvalidAddress},
+		{"to", valid().To("bar"), ErrInvalidAddress},
+		{"cc", valid().Cc("bar@"), ErrInvalidAddress},
+		{"bcc", valid().Bcc("bar@test.com, <baz"), ErrInvalidAddress},
+		{"reply-to", valid().ReplyTo("@test.com"), ErrInvalidAddress},
+		{"subject line break", valid().Subject("Hi\r\nBcc: evil@test.com"), ErrInvalidSubject},
+		{"subject control", valid().Subject("Hi\x1b"), ErrInvalidSubject},
+		{"subject not UTF-8", valid().Subject("Hi\xff"), ErrInvalidSubject},
+		{"subject too long", valid().Subject(strings.Repeat("a", maxSubjectLength+1)), ErrInvalidSubject},
+		{"message not UTF-8", valid().Message("Hi\xff"), ErrInvalidMessage},
+		{"HTML not UTF-8", valid().HTML("Hi\xff"), ErrInvalidMessage},
+		{"missing from", (&EmailBuilder{}).To("bar@test.com").Subject("Hello").Message("Hello"), ErrMissing},
+		{"missing to", (&EmailBuilder{}).From("foo@test.com").Subject("Hello").Message("Hello"), ErrMissing},
+		{"missing subject", (&EmailBuilder{}).From("foo@test.com").To("bar@test.com").Message("Hello"), ErrMissing},
+		{"missing message", (&EmailBuilder{}).From("foo@test.com").To("bar@test.com").Subject("Hello"), ErrMissing},
+	} {
+		e, err := tc.build.Build()
+		if !errors.Is(err, tc.want) || e != nil {
+			t.Errorf("%s: Build() = %v, %v, want %v", tc.name, e, err, tc.want)
+		}
+	}
+
+	// a subject of exactly the limit is fine, however many bytes it takes
+	if _, err := valid().Subject(strings.Repeat("件", maxSubjectLength)).Build(); err != nil {
+		t.Errorf("a subject of %d characters: %v", maxSubjectLength, err)
+	}
+}
+
+func TestBuildReportsEverything(t *testing.T) {
+	_, err := (&EmailBuilder{}).
+		From("foo.com").
+		Cc("bar").
+		Subject("Hi\r\nBcc: evil@test.com").
+		Build()
+	for _, want := range []error{ErrInvalidAddress, ErrInvalidSubject, ErrMissing} {
+		if !errors.Is(err, want) {
+			t.Errorf("Build() = %v, want %v among the errors", err, want)
+		}
+	}
+	if err == nil {
+		t.FailNow()
+	}
+
+	msg := err.Error()
+	for _, want := range []string{`from "foo.com"`, `cc "bar"`, "line breaks", "missing: to", "missing: message"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Build() = %v, want it to mention %s", err, want)
+		}
+	}
+	// the fields that were set to an invalid value are not missing too
+	for _, field := range []string{"from", "subject"} {
+		if strings.Contains(msg, "missing: "+field) {
+			t.Errorf("Build() = %v, want %s reported as invalid only", err, field)
+		}
+	}
+	if n := strings.Count(msg, "\n") + 1; n != 5 {
+		t.Errorf("Build() reported %d errors, want 5:\n%v", n, err)
+	}
+}
+
+func TestBuilderReuse(t *testing.T) {
+	eb := valid()
+	first, err := eb.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb.To("baz@test.com").Subject("Changed")
+	if em := first.(*email); len(em.to) != 1 || em.subject != "Hello" {
+		t.Errorf("changing the builder changed an email already built: to %v, subject %q", em.to, em.subject)
+	}
+
+	eb.From("foo.com")
+	if _, err := eb.Build(); err == nil {
+		t.Error("Build() after an invalid From succeeded")
+	}
+	if _, err := eb.Reset().Build(); !errors.Is(err, ErrMissing) || errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Build() after Reset = %v, want only %v", err, ErrMissing)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+type attachment struct {
+	name        string
+	contentType string
+	data        []byte
+	inline      bool // shown in the HTML body as cid:id
+}
+
+// HTML sets an HTML body. The plain text Message, when set, becomes the
+// alternative for clients that do not show HTML.
+func (eb *EmailBuilder) HTML(html string) *EmailBuilder {
+	if !utf8.ValidString(html) {
+		return eb.fail("message", fmt.Errorf("%w: HTML is not UTF-8", ErrInvalidMessage))
+	}
+	eb.current().html = html
+	return eb
+}
+
+// Attach adds a file, its content type is guessed from the name and
+// failing that from the data
+func (eb *EmailBuilder) Attach(name string, data []byte) *EmailBuilder {
+	return eb.attach(name, data, false)
+}
+
+// AttachFile adds a file read from disk
+func (eb *EmailBuilder) AttachFile(path string) *EmailBuilder {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return eb.fail("attachment", fmt.Errorf("attachment: %w", err))
+	}
+	return eb.attach(filepath.Base(path), data, false)
+}
+
+// Inline adds an image the HTML body shows by its Content-ID: the name,
+// with every character but letters, digits, '-', '_' and inner single dots
+// replaced by '-', at the domain of the sender. With a sender of
+// foo@test.com, Inline("logo.png", data) is <img src="cid:logo.png@test.com">
+// and Inline("my logo.png", data) <img src="cid:my-logo.png@test.com">.
+func (eb *EmailBuilder) Inline(name string, data []byte) *EmailBuilder {
+	for _, a := range eb.current().attachments {
+		if a.inline && contentId(a.name) == contentId(name) {
+			return eb.fail("attachment", fmt.Errorf("attachment: inline %q and %q have the same Content-ID", a.name, name))
+		}
+	}
+	return eb.attach(name, data, true)
+}
+
+// contentId keeps the characters of an inline name that are safe in a
+// Content-ID and in a cid: URL, the part before the @
+func contentId(name string) string {
+	id := []rune(name)
+	for i, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		case c == '.' && i > 0 && i < len(id)-1 && id[i-1] != '.':
+		default:
+			id[i] = '-'
+		}
+	}
+	return string(id)
+}
+
+func (eb *EmailBuilder) attach(name string, data []byte, inline bool) *EmailBuilder {
+	if name == "" || strings.ContainsAny(name, "\r\n\"<>") {
+		return eb.fail("attachment", fmt.Errorf("attachment: invalid name %q", name))
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	e := eb.current()
+	e.attachments = append(e.attachments, attachment{name: name, contentType: contentType, data: bytes.Clone(data), inline: inline})
+	return eb
+}
+
+// part is one MIME entity: its headers and a function writing its body
+type part struct {
+	header textproto.MIMEHeader
+	body   func(w io.Writer) error
+}
+
+// body builds the MIME tree of the email:
+//
+//	multipart/mixed            when there are attachments
+//	  multipart/alternative    when there is both text and HTML
+//	    text/plain
+//	    multipart/related      when there are inline images
+//	      text/html
+//	      image/...
+//	  application/pdf ...
+func (e *email) body() part {
+	var inline, attached []attachment
+	for _, a := range e.attachments {
+		if a.inline {
+			inline = append(inline, a)
+		} else {
+			attached = append(attached, a)
+		}
+	}
+
+	var content part
+	if e.html != "" {
+		content = textPart("text/html", e.html)
+		if len(inline) > 0 {
+			parts := []part{content}
+			for _, a := range inline {
+				parts = append(parts, attachmentPart(a, domainOf(e.from.Address)))
+			}
+			content = multipartPart("related", parts...)
+		}
+		if e.message != "" {
+			content = multipartPart("alternative", textPart("text/plain", e.message), content)
+		}
+	} else {
+		content = textPart("text/plain", e.message)
+	}
+
+	if len(attached) == 0 {
+		return content
+	}
+	parts := []part{content}
+	for _, a := range attached {
+		parts = append(parts, attachmentPart(a, ""))
+	}
+	return multipartPart("mixed", parts...)
+}
+
+// textPart is quoted-printable, which keeps ASCII text readable and
+// any line short enough for SMTP
+func textPart(contentType, text string) part {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return part{header: h, body: func(w io.Writer) error {
+		qp := quotedprintable.NewWriter(w)
+		if _, err := io.WriteString(qp, text); err != nil {
+			return err
+		}
+		return qp.Close()
+	}}
+}
+
+// attachmentPart gives inline attachments a Content-ID in domain
+func attachmentPart(a attachment, domain string) part {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(a.contentType, map[string]string{"name": a.name}))
+	h.Set("Content-Transfer-Encoding", "base64")
+	disposition := "attachment"
+	if a.inline {
+		disposition = "inline"
+		h.Set("Content-ID", "<"+contentId(a.name)+"@"+domain+">")
+	}
+	// FormatMediaType uses RFC 2231 for names that are not ASCII
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.name}))
+	return part{header: h, body: func(w io.Writer) error {
+		enc := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: w, max: 76})
+		if _, err := enc.Write(a.data); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\r\n")
+		return err
+	}}
+}
+
+func multipartPart(subtype string, parts ...part) part {
+	boundary := newBoundary()
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+	return part{header: h, body: func(w io.Writer) error {
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return err
+		}
+		for _, p := range parts {
+			pw, err := mw.CreatePart(p.header)
+			if err != nil {
+				return err
+			}
+			if err := p.body(pw); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}}
+}
+
+func newBoundary() string {
+	random := make([]byte, 15)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// lineWriter breaks its output into lines of at most max characters
+type lineWriter struct {
+	w    io.Writer
+	max  int
+	line int
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if lw.line == lw.max {
+			if _, err := io.WriteString(lw.w, "\r\n"); err != nil {
+				return written, err
+			}
+			lw.line = 0
+		}
+		n := min(len(p), lw.max-lw.line)
+		if _, err := lw.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		lw.line += n
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestContentId(t *testing.T) {
+	for name, want := range map[string]string{
+		"logo.png":     "logo.png",
+		"my logo.png":  "my-logo.png",
+		".hidden..png": "-hidden.-png",
+		"logo.":        "logo-",
+		"löwe.gif":     "l-we.gif",
+	} {
+		if got := contentId(name); got != want {
+			t.Errorf("contentId(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestInlineContentId(t *testing.T) {
+	e, err := (&EmailBuilder{}).
+		From("Foo <foo@test.com>").
+		To("bar@test.com").
+		Subject("Hello").
+		HTML(`<img src="cid:my-logo.png@test.com">`).
+		Inline("my logo.png", []byte("GIF89a")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(e.(*email).render()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	ids := []string{}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := p.Header.Get("Content-ID"); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if want := "<my-logo.png@test.com>"; strings.Join(ids, ",") != want {
+		t.Errorf("Content-IDs %q, want %s", ids, want)
+	}
+
+	_, err = (&EmailBuilder{}).Inline("my logo.png", nil).Inline("my-logo.png", nil).Build()
+	if err == nil || !strings.Contains(err.Error(), "same Content-ID") {
+		t.Errorf("two inline images with the same Content-ID: %v", err)
+	}
+}
+
+func TestInlineWithoutHTML(t *testing.T) {
+	eb := (&EmailBuilder{}).
+		From("foo@test.com").
+		To("bar@test.com").
+		Subject("Hello").
+		Message("No HTML here").
+		Inline("logo.png", []byte("GIF89a"))
+	if _, err := eb.Build(); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("inline image without HTML: Build() = %v, want %v", err, ErrInvalidMessage)
+	}
+
+	if _, err := eb.HTML(`<img src="cid:logo.png@test.com">`).Build(); err != nil {
+		t.Errorf("inline image with HTML: Build() = %v", err)
+	}
+}
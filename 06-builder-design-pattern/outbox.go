@@ -0,0 +1,527 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownMessage = errors.New("unknown message")
+
+type State string
+
+const (
+	StatePending State = "pending" // waiting for its next attempt
+	StateSending State = "sending"
+	StateSent    State = "sent"
+	StateDead    State = "dead" // gave up, see LastError
+)
+
+// DeliveryStatus is the delivery of a message to the recipients of one
+// domain. Domains are rate limited and retried separately.
+type DeliveryStatus struct {
+	Domain      string    `json:"domain"`
+	To          []string  `json:"to"`
+	State       State     `json:"state"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+type MessageStatus struct {
+	ID         string // the Message-ID of the email
+	State      State  // dead when any delivery is, once none is pending
+	QueuedAt   time.Time
+	Deliveries []DeliveryStatus
+}
+
+type OutboxConfig struct {
+	Dir       string // where queued messages are kept, one file each
+	Transport Transport
+	Workers   int
+
+	// a failed delivery is retried after BaseDelay, then twice as long
+	// every time up to MaxDelay, until MaxAttempts
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// every domain gets DomainRate messages a second, with bursts of up
+	// to DomainBurst
+	DomainRate  float64
+	DomainBurst int
+
+	// a message sent to every recipient is forgotten Retention after its
+	// last delivery, Status no longer knows it. Sent messages are kept
+	// forever when zero, dead ones always are until Retry.
+	Retention time.Duration
+
+	// OnError is told about the files that could not be written or
+	// removed once the message was queued, sending goes on anyway
+	OnError func(error)
+
+	// Now is the clock, time.Now when nil
+	Now func() time.Time
+}
+
+func DefaultOutboxConfig(dir string, t Transport) OutboxConfig {
+	return OutboxConfig{
+		Dir:         dir,
+		Transport:   t,
+		Workers:     4,
+		MaxAttempts: 8,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Minute,
+		DomainRate:  1,
+		DomainBurst: 5,
+		Retention:   24 * time.Hour,
+		Now:         time.Now,
+	}
+}
+
+// Outbox queues built emails on disk and sends them in the background
+// with its own transport, whatever transport the email was built with.
+// Messages queued before a restart are sent once it starts again.
+type Outbox struct {
+	cfg OutboxConfig
+
+	mu       sync.Mutex
+	messages map[string]*outboxMessage
+	pending  map[string]*outboxMessage // the messages with deliveries to send
+	buckets  map[string]*bucket
+	inFlight int
+
+	jobs chan job
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// outboxMessage is what is kept on disk, the message is rendered when it
+// is queued so every attempt sends the same Date and Message-ID
+type outboxMessage struct {
+	ID         string           `json:"id"`
+	From       string           `json:"from"`
+	Data       []byte           `json:"data"`
+	QueuedAt   time.Time        `json:"queued_at"`
+	Deliveries []DeliveryStatus `json:"deliveries"`
+}
+
+type job struct {
+	id       string
+	delivery int
+	from     string
+	to       []string
+	data     []byte
+}
+
+// NewOutbox loads the messages already queued in cfg.Dir, Start sends them
+func NewOutbox(cfg OutboxConfig) (*Outbox, error) {
+	if cfg.Transport == nil {
+		return nil, ErrNoTransport
+	}
+	if cfg.Workers < 1 || cfg.MaxAttempts < 1 || cfg.DomainRate <= 0 || cfg.DomainBurst < 1 {
+		return nil, errors.New("outbox: workers, attempts, rate and burst must be positive")
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{
+		cfg:      cfg,
+		messages: map[string]*outboxMessage{},
+		pending:  map[string]*outboxMessage{},
+		buckets:  map[string]*bucket{},
+		jobs:     make(chan job, cfg.Workers),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	files, err := filepath.Glob(filepath.Join(cfg.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m := &outboxMessage{}
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("outbox: %s: %w", file, err)
+		}
+		// the process stopped in the middle of these
+		for i := range m.Deliveries {
+			if m.Deliveries[i].State == StateSending {
+				m.Deliveries[i].State = StatePending
+			}
+		}
+		o.messages[m.ID] = m
+		if !m.done() {
+			o.pending[m.ID] = m
+		}
+	}
+	return o, nil
+}
+
+// Start runs the workers until Close
+func (o *Outbox) Start() {
+	o.wg.Add(1 + o.cfg.Workers)
+	go o.dispatch()
+	for range o.cfg.Workers {
+		go o.work()
+	}
+}
+
+// Close stops sending and waits for the messages being sent. The ones
+// still queued are sent by the next Outbox on the same directory.
+func (o *Outbox) Close() {
+	close(o.done)
+	o.wg.Wait()
+}
+
+// Enqueue renders the email and saves it before returning its Message-ID
+func (o *Outbox) Enqueue(e Email) (string, error) {
+	em, ok := e.(*email)
+	if !ok {
+		return "", fmt.Errorf("outbox: %T was not built by an EmailBuilder", e)
+	}
+
+	m := &outboxMessage{ID: em.messageId, From: em.from.Address, Data: em.render(), QueuedAt: o.cfg.Now()}
+	byDomain := map[string]int{}
+	for _, rcpt := range em.recipients() {
+		domain := strings.ToLower(rcpt[strings.LastIndex(rcpt, "@")+1:])
+		i, ok := byDomain[domain]
+		if !ok {
+			i = len(m.Deliveries)
+			byDomain[domain] = i
+			m.Deliveries = append(m.Deliveries, DeliveryStatus{Domain: domain, State: StatePending, NextAttempt: m.QueuedAt})
+		}
+		m.Deliveries[i].To = append(m.Deliveries[i].To, rcpt)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.messages[m.ID]; ok {
+		return "", fmt.Errorf("outbox: %s is already queued", m.ID)
+	}
+	if err := o.save(m); err != nil {
+		return "", err
+	}
+	o.messages[m.ID] = m
+	o.pending[m.ID] = m
+	o.notify()
+	return m.ID, nil
+}
+
+func (o *Outbox) Status(id string) (MessageStatus, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	m, ok := o.messages[id]
+	if !ok {
+		return MessageStatus{}, fmt.Errorf("%s: %w", id, ErrUnknownMessage)
+	}
+	return m.status(), nil
+}
+
+// DeadLetters lists the messages with a delivery that was given up
+func (o *Outbox) DeadLetters() []MessageStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	result := []MessageStatus{}
+	for _, m := range o.messages {
+		if slices.ContainsFunc(m.Deliveries, func(d DeliveryStatus) bool { return d.State == StateDead }) {
+			result = append(result, m.status())
+		}
+	}
+	slices.SortFunc(result, func(a, b MessageStatus) int { return a.QueuedAt.Compare(b.QueuedAt) })
+	return result
+}
+
+// Retry queues the dead deliveries of a message again, with a fresh
+// number of attempts
+func (o *Outbox) Retry(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	m, ok := o.messages[id]
+	if !ok {
+		return fmt.Errorf("%s: %w", id, ErrUnknownMessage)
+	}
+	for i := range m.Deliveries {
+		if d := &m.Deliveries[i]; d.State == StateDead {
+			d.State, d.Attempts, d.NextAttempt = StatePending, 0, o.cfg.Now()
+		}
+	}
+	if !m.done() {
+		o.pending[m.ID] = m
+	}
+	o.notify()
+	return o.save(m)
+}
+
+// done tells whether every delivery was sent or given up
+func (m *outboxMessage) done() bool {
+	return !slices.ContainsFunc(m.Deliveries, func(d DeliveryStatus) bool {
+		return d.State == StatePending || d.State == StateSending
+	})
+}
+
+// sentAt is when the last delivery of a message sent to every recipient
+// was, zero while any is not sent
+func (m *outboxMessage) sentAt() time.Time {
+	var last time.Time
+	for _, d := range m.Deliveries {
+		if d.State != StateSent {
+			return time.Time{}
+		}
+		if d.SentAt.After(last) {
+			last = d.SentAt
+		}
+	}
+	return last
+}
+
+func (m *outboxMessage) status() MessageStatus {
+	s := MessageStatus{ID: m.ID, QueuedAt: m.QueuedAt, State: StateSent}
+	dead := false
+	for _, d := range m.Deliveries {
+		d.To = slices.Clone(d.To)
+		s.Deliveries = append(s.Deliveries, d)
+		switch d.State {
+		case StateSending:
+			s.State = StateSending
+		case StatePending:
+			if s.State != StateSending {
+				s.State = StatePending
+			}
+		case StateDead:
+			dead = true
+		}
+	}
+	if dead && s.State == StateSent {
+		s.State = StateDead
+	}
+	return s
+}
+
+// dispatch hands the deliveries that are due to the workers, as far as
+// the workers and the rate limits of their domains allow, and prunes the
+// sent messages every pruneInterval
+func (o *Outbox) dispatch() {
+	defer o.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var pruned time.Time
+
+	for {
+		if now := o.cfg.Now(); now.Sub(pruned) >= pruneInterval {
+			o.prune(now)
+			pruned = now
+		}
+		wait := min(o.schedule(), pruneInterval)
+		timer.Reset(wait)
+		select {
+		case <-o.done:
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// schedule returns how long to wait before something else may be due
+func (o *Outbox) schedule() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.cfg.Now()
+	wait := time.Hour
+	ids := make([]string, 0, len(o.pending))
+	for id := range o.pending {
+		ids = append(ids, id)
+	}
+	// oldest first
+	slices.SortFunc(ids, func(a, b string) int { return o.pending[a].QueuedAt.Compare(o.pending[b].QueuedAt) })
+
+	for _, id := range ids {
+		m := o.pending[id]
+		for i := range m.Deliveries {
+			d := &m.Deliveries[i]
+			if d.State != StatePending {
+				continue
+			}
+			if o.inFlight == o.cfg.Workers {
+				// a worker finishing wakes the dispatcher up
+				return wait
+			}
+			if due := d.NextAttempt.Sub(now); due > 0 {
+				wait = min(wait, due)
+				continue
+			}
+			if delay := o.take(d.Domain, now); delay > 0 {
+				wait = min(wait, delay)
+				continue
+			}
+			d.State = StateSending
+			d.Attempts++
+			o.inFlight++
+			o.jobs <- job{id: m.ID, delivery: i, from: m.From, to: slices.Clone(d.To), data: m.Data}
+		}
+	}
+	return wait
+}
+
+func (o *Outbox) work() {
+	defer o.wg.Done()
+	for {
+		select {
+		case <-o.done:
+			return
+		case j := <-o.jobs:
+			o.finish(j, o.cfg.Transport.Send(j.from, j.to, j.data))
+		}
+	}
+}
+
+func (o *Outbox) finish(j job, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.inFlight--
+	m := o.messages[j.id]
+	d := &m.Deliveries[j.delivery]
+	switch {
+	case err == nil:
+		d.State, d.SentAt, d.LastError = StateSent, o.cfg.Now(), ""
+	case d.Attempts >= o.cfg.MaxAttempts || permanent(err):
+		d.State, d.LastError = StateDead, err.Error()
+	default:
+		d.State, d.LastError = StatePending, err.Error()
+		d.NextAttempt = o.cfg.Now().Add(o.backoff(d.Attempts))
+	}
+	if m.done() {
+		delete(o.pending, m.ID)
+	}
+	if err := o.save(m); err != nil && o.cfg.OnError != nil {
+		o.cfg.OnError(err)
+	}
+	o.notify()
+}
+
+// pruneInterval is how often the outbox looks for sent messages to forget
+const pruneInterval = time.Minute
+
+// prune removes the messages sent longer than the retention ago, from
+// memory and from disk
+func (o *Outbox) prune(now time.Time) {
+	if o.cfg.Retention <= 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for id, m := range o.messages {
+		sentAt := m.sentAt()
+		if sentAt.IsZero() || now.Sub(sentAt) < o.cfg.Retention {
+			continue
+		}
+		err := os.Remove(filepath.Join(o.cfg.Dir, fileName(id)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			if o.cfg.OnError != nil {
+				o.cfg.OnError(err)
+			}
+			continue
+		}
+		delete(o.messages, id)
+	}
+}
+
+// backoff doubles the delay after every attempt
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.cfg.BaseDelay
+	for i := 1; i < attempts && delay < o.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, o.cfg.MaxDelay)
+}
+
+// permanent tells the SMTP replies that retrying will not change, 5xx
+func permanent(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the message atomically, it expects the caller to hold the lock
+func (o *Outbox) save(m *outboxMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(o.cfg.Dir, fileName(m.ID))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fileName keeps the characters of a Message-ID that are safe in a path
+func fileName(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '@' {
+			return r
+		}
+		return '_'
+	}, id) + ".json"
+}
+
+// bucket is a token bucket limiting the messages sent to one domain
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take uses a token of the domain if there is one, or tells how long
+// until there is. It expects the caller to hold the lock.
+func (o *Outbox) take(domain string, now time.Time) time.Duration {
+	burst := float64(o.cfg.DomainBurst)
+	b, ok := o.buckets[domain]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		o.buckets[domain] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*o.cfg.DomainRate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / o.cfg.DomainRate * float64(time.Second))
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type transportFunc func(from string, to []string, msg []byte) error
+
+func (f transportFunc) Send(from string, to []string, msg []byte) error {
+	return f(from, to, msg)
+}
+
+func newTestEmail(t *testing.T, to ...string) Email {
+	t.Helper()
+	e, err := (&EmailBuilder{}).From("foo@test.com").To(to...).Subject("Hello").Message("Hello").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// waitFor polls the status of a message until it is no longer pending or
+// being sent
+func waitFor(t *testing.T, o *Outbox, id string) MessageStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := o.Status(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State == StateSent || status.State == StateDead {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s still not sent after 5s", id)
+	return MessageStatus{}
+}
+
+// newTestOutbox is not started, run drives it on the clock returned
+func newTestOutbox(t *testing.T, transport Transport, configure func(*OutboxConfig)) (*Outbox, *time.Time) {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := DefaultOutboxConfig(t.TempDir(), transport)
+	cfg.Now = func() time.Time { return now }
+	if configure != nil {
+		configure(&cfg)
+	}
+	o, err := NewOutbox(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o, &now
+}
+
+// run sends every delivery that is due the way the workers do and returns
+// how long the dispatcher would wait
+func run(o *Outbox) time.Duration {
+	for {
+		wait := o.schedule()
+		sent := false
+	drain:
+		for {
+			select {
+			case j := <-o.jobs:
+				o.finish(j, o.cfg.Transport.Send(j.from, j.to, j.data))
+				sent = true
+			default:
+				break drain
+			}
+		}
+		if !sent {
+			return wait
+		}
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	attempts := 0
+	failing := transportFunc(func(from string, to []string, msg []byte) error {
+		attempts++
+		return errors.New("connection reset")
+	})
+	o, now := newTestOutbox(t, failing, func(cfg *OutboxConfig) {
+		cfg.MaxAttempts, cfg.BaseDelay, cfg.MaxDelay = 5, time.Second, 4*time.Second
+	})
+	id, err := o.Enqueue(newTestEmail(t, "bar@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if wait := run(o); wait != delay {
+			t.Errorf("after attempt %d the dispatcher waits %v, want %v", i+1, wait, delay)
+		}
+		// not yet due
+		*now = now.Add(delay - time.Millisecond)
+		run(o)
+		if attempts != i+1 {
+			t.Fatalf("%d attempts %v after attempt %d, want %d", attempts, delay-time.Millisecond, i+1, i+1)
+		}
+		*now = now.Add(time.Millisecond)
+	}
+	run(o)
+
+	status, err := o.Status(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := status.Deliveries[0]
+	if attempts != 5 || status.State != StateDead || d.Attempts != 5 || d.LastError != "connection reset" {
+		t.Errorf("after %d attempts the message is %+v, want dead after 5", attempts, status)
+	}
+	if wait := run(o); attempts != 5 || wait != time.Hour {
+		t.Errorf("a dead delivery is tried again: %d attempts, the dispatcher waits %v", attempts, wait)
+	}
+}
+
+func TestOutboxBackoffThenSent(t *testing.T) {
+	attempts := 0
+	flaky := transportFunc(func(from string, to []string, msg []byte) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("try again later")
+		}
+		return nil
+	})
+	o, now := newTestOutbox(t, flaky, nil)
+	id, err := o.Enqueue(newTestEmail(t, "bar@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		*now = now.Add(run(o))
+	}
+	run(o)
+
+	status, err := o.Status(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := status.Deliveries[0]
+	want := time.Date(2024, 1, 1, 12, 0, 3, 0, time.UTC)
+	if status.State != StateSent || d.Attempts != 3 || d.LastError != "" || !d.SentAt.Equal(want) {
+		t.Errorf("the message is %+v, want sent at %v on the third attempt", status, want)
+	}
+}
+
+func TestOutboxRateLimit(t *testing.T) {
+	sent := map[string]int{}
+	transport := transportFunc(func(from string, to []string, msg []byte) error {
+		sent[to[0][strings.Index(to[0], "@")+1:]]++
+		return nil
+	})
+	o, now := newTestOutbox(t, transport, func(cfg *OutboxConfig) {
+		cfg.Workers, cfg.DomainRate, cfg.DomainBurst = 10, 2, 3
+	})
+	for range 6 {
+		if _, err := o.Enqueue(newTestEmail(t, "bar@test.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := o.Enqueue(newTestEmail(t, "bar@other.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		after time.Duration
+		sent  int
+		wait  time.Duration
+	}{
+		// a burst, then 2 a second
+		{0, 3, 500 * time.Millisecond},
+		{250 * time.Millisecond, 3, 250 * time.Millisecond},
+		{250 * time.Millisecond, 4, 500 * time.Millisecond},
+		{time.Second, 6, time.Hour},
+	} {
+		*now = now.Add(step.after)
+		wait := run(o)
+		if sent["test.com"] != step.sent || wait != step.wait {
+			t.Errorf("at %s: %d sent to test.com, waiting %v, want %d and %v",
+				now.Format(time.TimeOnly+".000"), sent["test.com"], wait, step.sent, step.wait)
+		}
+		// the other domain has its own limit
+		if sent["other.com"] != 1 {
+			t.Errorf("at %s: %d sent to other.com, want 1", now.Format(time.TimeOnly+".000"), sent["other.com"])
+		}
+	}
+}
+
+func TestOutboxDomains(t *testing.T) {
+	var sends [][]string
+	transport := transportFunc(func(from string, to []string, msg []byte) error {
+		sends = append(sends, to)
+		if strings.HasSuffix(to[0], "@down.com") {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	o, _ := newTestOutbox(t, transport, nil)
+	id, err := o.Enqueue(newTestEmail(t, "bar@test.com", "qux@down.com", "Baz@TEST.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(o)
+
+	if len(sends) != 2 {
+		t.Fatalf("%d sends, want one per domain: %q", len(sends), sends)
+	}
+	status, err := o.Status(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Deliveries) != 2 {
+		t.Fatalf("%d deliveries, want 2: %+v", len(status.Deliveries), status.Deliveries)
+	}
+	for i, want := range []struct {
+		domain, to string
+		state      State
+	}{
+		{"test.com", "bar@test.com,Baz@TEST.com", StateSent},
+		{"down.com", "qux@down.com", StatePending},
+	} {
+		d := status.Deliveries[i]
+		if d.Domain != want.domain || strings.Join(d.To, ",") != want.to || d.State != want.state {
+			t.Errorf("delivery %d = %+v, want %s to %s %s", i, d, want.domain, want.to, want.state)
+		}
+	}
+	// one failing domain keeps the message pending, not the others
+	if status.State != StatePending {
+		t.Errorf("the message is %s, want %s", status.State, StatePending)
+	}
+}
+
+func TestOutboxPrune(t *testing.T) {
+	dir := t.TempDir()
+	failing := transportFunc(func(from string, to []string, msg []byte) error {
+		if to[0] == "bar@dead.com" {
+			return &textproto.Error{Code: 550, Msg: "no such user"}
+		}
+		return nil
+	})
+	o, err := NewOutbox(DefaultOutboxConfig(dir, failing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Start()
+	defer o.Close()
+
+	sent, err := o.Enqueue(newTestEmail(t, "bar@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := o.Enqueue(newTestEmail(t, "bar@dead.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := waitFor(t, o, sent); status.State != StateSent {
+		t.Fatalf("%s is %s, want %s", sent, status.State, StateSent)
+	}
+	if status := waitFor(t, o, dead); status.State != StateDead {
+		t.Fatalf("%s is %s, want %s", dead, status.State, StateDead)
+	}
+
+	o.mu.Lock()
+	pending := len(o.pending)
+	o.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d messages left to schedule, want none", pending)
+	}
+
+	// still within the retention
+	o.prune(time.Now())
+	if _, err := o.Status(sent); err != nil {
+		t.Errorf("Status of a message just sent: %v", err)
+	}
+
+	o.prune(time.Now().Add(o.cfg.Retention))
+	if _, err := o.Status(sent); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Status after the retention = %v, want %v", err, ErrUnknownMessage)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fileName(sent))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the file of a pruned message is still there: %v", err)
+	}
+	if _, err := o.Status(dead); err != nil {
+		t.Errorf("Status of a dead message after the retention: %v", err)
+	}
+}
+
+func TestSendThroughOutboxDead(t *testing.T) {
+	// the first domain is sent, the second one is not
+	transport := transportFunc(func(from string, to []string, msg []byte) error {
+		if to[0] == "baz@dead.com" {
+			return &textproto.Error{Code: 550, Msg: "no such user"}
+		}
+		return nil
+	})
+	err := sendThroughOutbox(t.TempDir(), transport, newTestEmail(t, "bar@test.com", "baz@dead.com"))
+	if err == nil || !strings.Contains(err.Error(), "dead.com: 550") || !strings.Contains(err.Error(), "no such user") {
+		t.Errorf("sendThroughOutbox = %v, want the error of dead.com", err)
+	}
+}
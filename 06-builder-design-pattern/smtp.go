@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+type TLSPolicy int
+
+const (
+	// TLSOpportunistic uses STARTTLS when the server offers it
+	TLSOpportunistic TLSPolicy = iota
+	// TLSRequired fails when the server does not offer STARTTLS
+	TLSRequired
+	// TLSNone never uses STARTTLS
+	TLSNone
+)
+
+// SMTPTransport sends messages to an SMTP server, upgrading the connection
+// with STARTTLS according to its policy and authenticating when a username
+// is set. Every Send uses a new connection.
+type SMTPTransport struct {
+	Addr      string // host:port
+	LocalName string // sent with EHLO
+	TLS       TLSPolicy
+	TLSConfig *tls.Config // the server name defaults to the host of Addr
+
+	// PLAIN authentication, which net/smtp only allows over TLS or to localhost
+	Username string
+	Password string
+
+	Timeout time.Duration // for the whole conversation
+}
+
+func NewSMTPTransport(addr string) *SMTPTransport {
+	return &SMTPTransport{Addr: addr, LocalName: "localhost", Timeout: time.Minute}
+}
+
+func (t *SMTPTransport) Send(from string, to []string, msg []byte) error {
+	if len(to) == 0 {
+		return errors.New("smtp: no recipients")
+	}
+	host, _, err := net.SplitHostPort(t.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", t.Addr, t.Timeout)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if t.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(t.Timeout))
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if err := t.send(c, host, from, to, msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+func (t *SMTPTransport) send(c *smtp.Client, host, from string, to []string, msg []byte) error {
+	if err := c.Hello(t.LocalName); err != nil {
+		return err
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok && t.TLS != TLSNone {
+		cfg := &tls.Config{ServerName: host}
+		if t.TLSConfig != nil {
+			cfg = t.TLSConfig.Clone()
+			if cfg.ServerName == "" {
+				cfg.ServerName = host
+			}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return err
+		}
+	} else if t.TLS == TLSRequired {
+		return errors.New("server does not support STARTTLS")
+	}
+
+	if t.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("server does not support authentication")
+		}
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestTLS returns a server config with a self-signed certificate for
+// 127.0.0.1 and a client config trusting it
+func newTestTLS(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func startFakeSMTP(t *testing.T, s *FakeSMTPServer) *FakeSMTPServer {
+	t.Helper()
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSMTPTransport(t *testing.T) {
+	serverTLS, clientTLS := newTestTLS(t)
+	msg := []byte("Subject: Hello\r\n\r\nHello\r\n.starts with a dot\r\n")
+
+	for _, tc := range []struct {
+		name      string
+		server    *FakeSMTPServer
+		transport SMTPTransport
+		fails     string
+	}{
+		{name: "plain", server: &FakeSMTPServer{}, transport: SMTPTransport{}},
+		{
+			name:      "starttls and auth",
+			server:    &FakeSMTPServer{TLSConfig: serverTLS, Username: "foo", Password: "secret"},
+			transport: SMTPTransport{TLSConfig: clientTLS, Username: "foo", Password: "secret"},
+		},
+		{
+			name:      "auth without tls to localhost",
+			server:    &FakeSMTPServer{Username: "foo", Password: "secret"},
+			transport: SMTPTransport{Username: "foo", Password: "secret"},
+		},
+		{
+			name:      "wrong password",
+			server:    &FakeSMTPServer{TLSConfig: serverTLS, Username: "foo", Password: "secret"},
+			transport: SMTPTransport{TLSConfig: clientTLS, Username: "foo", Password: "wrong"},
+			fails:     "535",
+		},
+		{
+			name:      "tls required but not offered",
+			server:    &FakeSMTPServer{},
+			transport: SMTPTransport{TLS: TLSRequired},
+			fails:     "STARTTLS",
+		},
+		{
+			name:      "tls refused by the client",
+			server:    &FakeSMTPServer{TLSConfig: serverTLS},
+			transport: SMTPTransport{TLS: TLSNone},
+			fails:     "530",
+		},
+		{
+			name:      "untrusted certificate",
+			server:    &FakeSMTPServer{TLSConfig: serverTLS},
+			transport: SMTPTransport{},
+			fails:     "certificate",
+		},
+		{
+			name:      "no auth offered",
+			server:    &FakeSMTPServer{},
+			transport: SMTPTransport{Username: "foo", Password: "secret"},
+			fails:     "authentication",
+		},
+	} {
+		server := startFakeSMTP(t, tc.server)
+		transport := tc.transport
+		transport.Addr, transport.LocalName, transport.Timeout = server.Addr(), "localhost", 5*time.Second
+
+		err := transport.Send("foo@test.com", []string{"bar@test.com", "baz@test.com"}, msg)
+		if tc.fails != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.fails) {
+				t.Errorf("%s: Send() = %v, want an error about %s", tc.name, err, tc.fails)
+			}
+			if got := server.Messages(); len(got) != 0 {
+				t.Errorf("%s: the server received %d messages, want none", tc.name, len(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Send() = %v", tc.name, err)
+			continue
+		}
+		got := server.Messages()
+		if len(got) != 1 {
+			t.Errorf("%s: the server received %d messages, want 1", tc.name, len(got))
+			continue
+		}
+		if got[0].From != "foo@test.com" || strings.Join(got[0].To, ",") != "bar@test.com,baz@test.com" || string(got[0].Data) != string(msg) {
+			t.Errorf("%s: the server received %+v, want %q", tc.name, got[0], msg)
+		}
+	}
+}
+
+func TestFakeSMTPServerCloseIdle(t *testing.T) {
+	s := &FakeSMTPServer{CloseTimeout: 100 * time.Millisecond}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// a client that connects and never says anything
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 100)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Close() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close still waiting for an idle connection after 5s")
+	}
+}
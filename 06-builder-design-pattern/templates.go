@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+var ErrTemplate = errors.New("invalid template")
+
+// Templates holds the templates of named emails. An email called welcome
+// is made of up to three templates:
+//
+//	welcome.subject  text/template, required
+//	welcome.txt      text/template, the plain text message
+//	welcome.html     html/template, the HTML body
+//
+// It needs a message, an HTML body or both. A template referring to data
+// that is not there is an error rather than "<no value>".
+type Templates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func NewTemplates() *Templates {
+	return &Templates{
+		text: texttemplate.New("").Option("missingkey=error"),
+		html: htmltemplate.New("").Option("missingkey=error"),
+	}
+}
+
+// LoadTemplates parses the files matching the patterns, usually from an
+// embed.FS. A file is named after its template with a .tmpl extension,
+// welcome.html.tmpl for instance. Templates of one kind can use the
+// {{define}} blocks of one another.
+func LoadTemplates(fsys fs.FS, patterns ...string) (*Templates, error) {
+	ts := NewTemplates()
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%w: no files match %s", ErrTemplate, pattern)
+		}
+		for _, file := range files {
+			content, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			if err := ts.Parse(strings.TrimSuffix(path.Base(file), ".tmpl"), string(content)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ts, nil
+}
+
+// Parse adds a template, its name ends with .subject, .txt or .html
+func (ts *Templates) Parse(name, content string) error {
+	var err error
+	switch path.Ext(name) {
+	case ".html":
+		_, err = ts.html.New(name).Parse(content)
+	case ".subject", ".txt":
+		_, err = ts.text.New(name).Parse(content)
+	default:
+		return fmt.Errorf("%w: %s is not a .subject, .txt or .html template", ErrTemplate, name)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTemplate, err)
+	}
+	return nil
+}
+
+// render executes the templates of the named email, the subject is
+// trimmed so the template can end with a newline
+func (ts *Templates) render(name string, data any) (subject, text, html string, err error) {
+	var errs []error
+	execute := func(t interface{ Execute(io.Writer, any) error }) string {
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %v", ErrTemplate, err))
+		}
+		return b.String()
+	}
+
+	if t := ts.text.Lookup(name + ".subject"); t != nil {
+		subject = strings.TrimSpace(execute(t))
+	} else {
+		errs = append(errs, fmt.Errorf("%w: %s.subject is not defined", ErrTemplate, name))
+	}
+	textTemplate, htmlTemplate := ts.text.Lookup(name+".txt"), ts.html.Lookup(name+".html")
+	if textTemplate != nil {
+		text = execute(textTemplate)
+	}
+	if htmlTemplate != nil {
+		html = execute(htmlTemplate)
+	}
+	if textTemplate == nil && htmlTemplate == nil {
+		errs = append(errs, fmt.Errorf("%w: %s has neither a .txt nor an .html template", ErrTemplate, name))
+	}
+	return subject, text, html, errors.Join(errs...)
+}
+
+// Template renders the subject, message and HTML body of the named email
+// with data when the email is built, replacing any set before
+func (eb *EmailBuilder) Template(ts *Templates, name string, data any) *EmailBuilder {
+	if ts == nil {
+		return eb.fail("template", fmt.Errorf("%w: no templates", ErrTemplate))
+	}
+	e := eb.current()
+	e.template = &templateCall{templates: ts, name: name, data: data}
+	return eb
+}
+
+type templateCall struct {
+	templates *Templates
+	name      string
+	data      any
+}
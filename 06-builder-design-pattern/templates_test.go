@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func buildTemplate(ts *Templates, name string, data any) (*email, error) {
+	e, err := (&EmailBuilder{}).From("foo@test.com").To("bar@test.com").Template(ts, name, data).Build()
+	if err != nil {
+		return nil, err
+	}
+	return e.(*email), nil
+}
+
+func TestLoadTemplates(t *testing.T) {
+	ts, err := LoadTemplates(templateFiles, "templates/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := buildTemplate(ts, "greeting", map[string]string{"Name": "Bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.subject != "Greeting for Bar" {
+		t.Errorf("subject %q, want Greeting for Bar", e.subject)
+	}
+	if !strings.HasPrefix(e.message, "Hello Bar!\n") {
+		t.Errorf("message %q, want it to start with Hello Bar!", e.message)
+	}
+	if !strings.HasPrefix(e.html, "<p>Hello <b>Bar</b>!</p>") {
+		t.Errorf("HTML %q, want it to start with <p>Hello <b>Bar</b>!</p>", e.html)
+	}
+
+	for _, pattern := range []string{"templates/*.missing", "["} {
+		if _, err := LoadTemplates(templateFiles, pattern); err == nil {
+			t.Errorf("LoadTemplates(%q) succeeded", pattern)
+		}
+	}
+	bad := fstest.MapFS{
+		"welcome.md.tmpl":      {Data: []byte("Hello")},
+		"welcome.subject.tmpl": {Data: []byte("Hello {{.Name")},
+	}
+	for _, pattern := range []string{"welcome.md.tmpl", "welcome.subject.tmpl"} {
+		if _, err := LoadTemplates(bad, pattern); !errors.Is(err, ErrTemplate) {
+			t.Errorf("LoadTemplates(%s) = %v, want %v", pattern, err, ErrTemplate)
+		}
+	}
+}
+
+func TestTemplateHTMLEscaping(t *testing.T) {
+	ts := NewTemplates()
+	for name, content := range map[string]string{
+		"welcome.subject": "Welcome {{.Name}}",
+		"welcome.txt":     "Hello {{.Name}}",
+		"welcome.html":    `<p>Hello {{.Name}}</p><a href="{{.Link}}">home</a>`,
+	} {
+		if err := ts.Parse(name, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := map[string]string{"Name": "<b>Tom & Jerry</b>", "Link": "javascript:alert(1)"}
+	e, err := buildTemplate(ts, "welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>Hello &lt;b&gt;Tom &amp; Jerry&lt;/b&gt;</p>"; !strings.Contains(e.html, want) {
+		t.Errorf("HTML %q, want the name escaped as %s", e.html, want)
+	}
+	if strings.Contains(e.html, "javascript:") {
+		t.Errorf("HTML %q keeps an unsafe URL", e.html)
+	}
+	// only the HTML is escaped
+	if e.subject != "Welcome <b>Tom & Jerry</b>" || e.message != "Hello <b>Tom & Jerry</b>" {
+		t.Errorf("subject %q and message %q, want them as given", e.subject, e.message)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	ts := NewTemplates()
+	for name, content := range map[string]string{
+		"textonly.subject":  "Hello\n",
+		"textonly.txt":      "Hello {{.Name}}",
+		"htmlonly.subject":  "Hello",
+		"htmlonly.html":     "<p>Hello</p>",
+		"nobody.subject":    "Hello",
+		"nosubject.txt":     "Hello",
+		"multiline.subject": "Hello {{.Name}}\nBcc: evil@test.com",
+		"multiline.txt":     "Hello",
+	} {
+		if err := ts.Parse(name, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.Parse("welcome.md", "Hello"); !errors.Is(err, ErrTemplate) {
+		t.Errorf("Parse(welcome.md) = %v, want %v", err, ErrTemplate)
+	}
+
+	data := map[string]string{"Name": "Bar"}
+	for _, name := range []string{"textonly", "htmlonly"} {
+		if _, err := buildTemplate(ts, name, data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		data any
+		want error
+	}{
+		{"missing", data, ErrTemplate},
+		{"nobody", data, ErrTemplate},
+		{"nosubject", data, ErrTemplate},
+		{"textonly", map[string]string{}, ErrTemplate},
+		{"multiline", data, ErrInvalidSubject},
+	} {
+		_, err := buildTemplate(ts, tc.name, tc.data)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s with %v: Build() = %v, want %v", tc.name, tc.data, err, tc.want)
+		}
+		// the template failed, so the subject and message are not missing
+		if errors.Is(err, ErrMissing) {
+			t.Errorf("%s with %v: Build() = %v, want no %v", tc.name, tc.data, err, ErrMissing)
+		}
+	}
+
+	if _, err := (&EmailBuilder{}).Template(nil, "welcome", nil).Build(); !errors.Is(err, ErrTemplate) {
+		t.Errorf("Template(nil) = %v, want %v", err, ErrTemplate)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoTransport = errors.New("email has no transport")
+
+// Transport delivers a rendered message to every recipient of the envelope.
+// It knows nothing about how the message was built.
+type Transport interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+// render writes the message in RFC 5322 format, lines end with CRLF
+func (e *email) render() []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	addresses := func(name string, list []*mail.Address) {
+		if len(list) == 0 {
+			return
+		}
+		values := make([]string, len(list))
+		for i, addr := range list {
+			values[i] = addr.String()
+		}
+		header(name, strings.Join(values, ", "))
+	}
+
+	// Bcc never appears, its recipients are only in the envelope
+	header("From", e.from.String())
+	addresses("To", e.to)
+	addresses("Cc", e.cc)
+	if len(e.to)+len(e.cc) == 0 {
+		header("To", "undisclosed-recipients:;")
+	}
+	addresses("Reply-To", e.replyTo)
+	header("Subject", encodeSubject(e.subject))
+	header("Date", e.date.Format(time.RFC1123Z))
+	header("Message-ID", e.messageId)
+	header("MIME-Version", "1.0")
+	for _, h := range append(e.priority.headers(), e.headers...) {
+		header(h.name, h.value)
+	}
+
+	body := e.body()
+	for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if value := body.header.Get(name); value != "" {
+			header(name, value)
+		}
+	}
+	b.WriteString("\r\n")
+	// writing to a bytes.Buffer cannot fail
+	body.body(&b)
+	return b.Bytes()
+}
+
+// encodeSubject Q-encodes a subject that is not plain ASCII. The encoder
+// splits it into encoded words of at most 75 characters, which are folded
+// on lines of their own so a long subject never makes a long line.
+func encodeSubject(subject string) string {
+	encoded := mime.QEncoding.Encode("utf-8", subject)
+	if encoded == subject {
+		return subject
+	}
+	// encoded words never contain spaces, only the encoder puts them in
+	// between
+	return strings.ReplaceAll(encoded, " ", "\r\n ")
+}
+
+// newMessageId returns a globally unique id in the domain of the sender
+func newMessageId(from string) string {
+	random := make([]byte, 16)
+	rand.Read(random)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(random), time.Now().UnixNano(), domainOf(from))
+}
+
+// domainOf is the domain of an address, localhost when there is none
+func domainOf(from string) string {
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		return strings.Trim(from[i+1:], "> ")
+	}
+	return "localhost"
+}
+
+// MemoryTransport keeps every message it is given, for tests and dry runs
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+type SentMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+func (t *MemoryTransport) Send(from string, to []string, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, SentMessage{From: from, To: append([]string{}, to...), Data: bytes.Clone(msg)})
+	return nil
+}
+
+func (t *MemoryTransport) Messages() []SentMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SentMessage{}, t.messages...)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestRenderLongSubject(t *testing.T) {
+	subject := strings.Repeat("件", maxSubjectLength)
+	e, err := (&EmailBuilder{}).
+		From("foo@test.com").
+		To("bar@test.com").
+		Subject(subject).
+		Message("Hello").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := e.(*email).render()
+
+	for i, line := range bytes.Split(msg, []byte("\r\n")) {
+		if len(line) > 998 {
+			t.Errorf("line %d has %d characters, more than 998", i+1, len(line))
+		}
+		for _, word := range strings.Fields(string(line)) {
+			if strings.HasPrefix(word, "=?") && len(word) > 75 {
+				t.Errorf("line %d: encoded word of %d characters, more than 75: %s", i+1, len(word), word)
+			}
+		}
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != subject {
+		t.Errorf("the subject reads back as %q, want %q", got, subject)
+	}
+}
+
+func TestSendBcc(t *testing.T) {
+	var envelope []string
+	var msg []byte
+	e, err := (&EmailBuilder{}).
+		From("foo@test.com").
+		To("Bar <bar@test.com>").
+		Cc("baz@test.com").
+		Bcc("archive@test.com", "BAR@test.com").
+		Subject("Hello").
+		Message("Hello").
+		Transport(transportFunc(func(from string, to []string, m []byte) error {
+			envelope, msg = to, m
+			return nil
+		})).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(envelope, ","), "bar@test.com,baz@test.com,archive@test.com"; got != want {
+		t.Errorf("envelope %s, want %s", got, want)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("the message has a Bcc header: %s", bcc)
+	}
+	if bytes.Contains(msg, []byte("archive@test.com")) {
+		t.Errorf("a Bcc address is in the message:\n%s", msg)
+	}
+}
+
+func TestSendOnlyBcc(t *testing.T) {
+	e, err := (&EmailBuilder{}).From("foo@test.com").Bcc("bar@test.com").Subject("Hello").Message("Hello").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(e.(*email).render()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := parsed.Header.Get("To"); to != "undisclosed-recipients:;" {
+		t.Errorf("To: %s, want undisclosed-recipients:;", to)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name, value string
+		valid       bool
+	}{
+		{"X-Campaign", "spring sale", true},
+		{"x-campaign", "Spring Sale", true},
+		{"X Campaign", "spring", false},
+		{"X-Campaign:", "spring", false},
+		{"Subject", "spring", false},
+		{"bcc", "bar@test.com", false},
+		{"X-Campaign", "spring\r\nBcc: bar@test.com", false},
+		{"X-Campaign", "spring\x00", false},
+		{"X-Campaign", "spring\tsale", false},
+		{"X-Campaign", "spring\x7f", false},
+	} {
+		_, err := (&EmailBuilder{}).
+			From("foo@test.com").
+			To("bar@test.com").
+			Subject("Hello").
+			Message("Hello").
+			Header(tc.name, tc.value).
+			Build()
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("Header(%q, %q): Build() = %v, want valid %v", tc.name, tc.value, err, tc.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Header(%q, %q): Build() = %v, want %v", tc.name, tc.value, err, ErrInvalidHeader)
+		}
+	}
+}
+
+func TestEncodeSubject(t *testing.T) {
+	for _, subject := range []string{"Hello", "Hello world", "Grüße aus Köln", "件名 " + strings.Repeat("件", 40)} {
+		encoded := encodeSubject(subject)
+		if !strings.ContainsFunc(subject, func(r rune) bool { return r > '~' }) && encoded != subject {
+			t.Errorf("encodeSubject(%q) = %q, want ASCII kept as is", subject, encoded)
+		}
+		for _, line := range strings.Split(encoded, "\r\n") {
+			if len(line) > 78 {
+				t.Errorf("encodeSubject(%q) has a line of %d characters: %q", subject, len(line), line)
+			}
+		}
+		// unfolding gives back the encoded words the decoder expects
+		got, err := new(mime.WordDecoder).DecodeHeader(strings.ReplaceAll(encoded, "\r\n", ""))
+		if err != nil || got != subject {
+			t.Errorf("encodeSubject(%q) = %q, decodes to %q, %v", subject, encoded, got, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// ABACPolicy grants permissions by attributes rather than by roles. Every
+// rule has an effect and a condition (see expr.go), and may be limited to
+// some operations:
+//
+//	{
+//		"rules": [
+//			{"name": "own-posts", "effect": "allow", "actions": ["update", "delete"],
+//			 "condition": "resource.type == \"post\" && resource.owner == subject.id"},
+//			{"name": "outside-office", "effect": "deny", "actions": ["delete"],
+//			 "condition": "!ip_in(env.ip, \"10.0.0.0/8\")"}
+//		]
+//	}
+//
+// A deny overrides any allow, and nothing is allowed unless a rule allows it.
+type ABACPolicy struct {
+	Rules []ABACRule `json:"rules"`
+}
+
+type ABACRule struct {
+	Name      string   `json:"name"`
+	Effect    string   `json:"effect"`
+	Actions   []string `json:"actions,omitempty"` // operation names, every operation when empty
+	Condition string   `json:"condition,omitempty"`
+}
+
+// ParseABACPolicy reads a JSON policy like ParsePolicy does, NewEngine
+// validates it
+func ParseABACPolicy(r io.Reader) (*ABACPolicy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	p := &ABACPolicy{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return p, nil
+}
+
+// Request is everything a decision may depend on
+type Request struct {
+	Subject     Subject
+	Resource    Resource
+	Operation   Operation
+	Environment Environment
+}
+
+// Environment is where and when a request is made
+type Environment struct {
+	Time time.Time // now when zero
+	IP   netip.Addr
+}
+
+// Engine evaluates an ABAC policy, it is safe for concurrent use
+type Engine struct {
+	rules []abacRule
+}
+
+type abacRule struct {
+	name       string
+	allow      bool
+	operations Operations // every operation when empty
+	condition  expr       // always true when nil
+}
+
+// NewEngine reports every problem of the policy at once: rules without a
+// name or with the same name, unknown effects and operations, and
+// conditions that do not parse
+func NewEngine(p *ABACPolicy) (*Engine, error) {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidPolicy}, args...)...))
+	}
+
+	e := &Engine{}
+	names := map[string]bool{}
+	for i, r := range p.Rules {
+		// rules without a name are numbered
+		label := fmt.Sprintf("%q", r.Name)
+		switch {
+		case r.Name == "":
+			label = strconv.Itoa(i + 1)
+			fail("rule %s has no name", label)
+		case names[r.Name]:
+			fail("rule %s defined twice", label)
+		}
+		names[r.Name] = true
+
+		rule := abacRule{name: r.Name, allow: r.Effect == EffectAllow}
+		if r.Effect != EffectAllow && r.Effect != EffectDeny {
+			fail("rule %s: unknown effect %q", label, r.Effect)
+		}
+		for _, name := range r.Actions {
+			op, err := ParseOperation(name)
+			if err != nil {
+				fail("rule %s: %v", label, err)
+			}
+			rule.operations = rule.operations.Union(NewOperations(op))
+		}
+		if r.Condition != "" {
+			condition, err := parseCondition(r.Condition)
+			if err != nil {
+				fail("rule %s: %v", label, err)
+			}
+			rule.condition = condition
+		}
+		e.rules = append(e.rules, rule)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Evaluate goes through the rules in order. The first deny that matches
+// decides, otherwise the first allow that matched.
+func (e *Engine) Evaluate(req Request) Decision {
+	if req.Environment.Time.IsZero() {
+		req.Environment.Time = time.Now()
+	}
+
+	var allowed *abacRule
+	for i := range e.rules {
+		r := &e.rules[i]
+		if allowed != nil && r.allow {
+			continue
+		}
+		matched, err := r.matches(&req)
+		if err != nil {
+			return Decision{Rule: r.name, Err: fmt.Errorf("rule %q: %w", r.name, err)}
+		}
+		if !matched {
+			continue
+		}
+		if !r.allow {
+			return Decision{Rule: r.name}
+		}
+		allowed = r
+	}
+	if allowed == nil {
+		return Decision{}
+	}
+	return Decision{Allowed: true, Rule: allowed.name}
+}
+
+func (r *abacRule) matches(req *Request) (bool, error) {
+	if r.operations != 0 && !r.operations.Has(req.Operation) {
+		return false, nil
+	}
+	if r.condition == nil {
+		return true, nil
+	}
+	return evalBool(r.condition, req)
+}
+
+// NewPermission creates the permission of a subject making requests from an
+// environment. IsAllow evaluates the policy without a resource, so rules
+// about resources do not match.
+func (e *Engine) NewPermission(subject Subject, env Environment) Permission {
+	// a copy, the caller changing its attributes changes no decision
+	subject.Attributes = maps.Clone(subject.Attributes)
+	return &abacPermission{engine: e, subject: subject, env: env}
+}
+
+type abacPermission struct {
+	engine  *Engine
+	subject Subject
+	env     Environment
+}
+
+// Subject is who the permission was created for, a copy
+func (p *abacPermission) Subject() Subject {
+	s := p.subject
+	s.Attributes = maps.Clone(s.Attributes)
+	return s
+}
+
+func (p *abacPermission) IsAllow(operation Operation) bool {
+	return p.Decide(operation, Resource{}).Allowed
+}
+
+func (p *abacPermission) IsAllowOn(operation Operation, resource Resource) bool {
+	return p.Decide(operation, resource).Allowed
+}
+
+// Decide is IsAllowOn telling which rule decided
+func (p *abacPermission) Decide(operation Operation, resource Resource) Decision {
+	return p.engine.Evaluate(Request{Subject: p.subject, Resource: resource, Operation: operation, Environment: p.env})
+}
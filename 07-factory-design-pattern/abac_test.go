@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEngine(t *testing.T, rules ...ABACRule) *Engine {
+	t.Helper()
+	e, err := NewEngine(&ABACPolicy{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	_, err := NewEngine(&ABACPolicy{Rules: []ABACRule{
+		{Effect: EffectAllow},
+		{Name: "twice", Effect: EffectAllow},
+		{Name: "twice", Effect: EffectAllow},
+		{Name: "effect", Effect: "maybe"},
+		{Name: "action", Effect: EffectAllow, Actions: []string{"publish"}},
+		{Name: "condition", Effect: EffectAllow, Condition: "subject.id =="},
+		{Name: "cidr", Effect: EffectDeny, Condition: `ip_in(env.ip, "10.0.0.0/40")`},
+	}})
+	if !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("NewEngine = %v, want %v", err, ErrInvalidPolicy)
+	}
+	// every problem is reported
+	for _, want := range []string{"rule 1 has no name", `"twice" defined twice`, `unknown effect "maybe"`, `unknown operation "publish"`, `rule "condition"`, `rule "cidr"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("NewEngine error does not say %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	e := newTestEngine(t,
+		ABACRule{Name: "own-posts", Effect: EffectAllow, Condition: `resource.owner == subject.id`},
+		ABACRule{Name: "readers", Effect: EffectAllow, Actions: []string{"read"}},
+		ABACRule{Name: "outside-office", Effect: EffectDeny, Actions: []string{"delete"}, Condition: `!ip_in(env.ip, "10.0.0.0/8")`},
+		ABACRule{Name: "night", Effect: EffectDeny, Actions: []string{"create", "update", "delete"}, Condition: `env.time < "07:00" || env.time >= "21:00"`},
+	)
+	liz := Subject{ID: "liz", Role: "author"}
+	post := Resource{Type: "post", Owner: "liz"}
+	office := Environment{Time: time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC), IP: netip.MustParseAddr("10.0.0.1")}
+	home := office
+	home.IP = netip.MustParseAddr("203.0.113.7")
+	night := office
+	night.Time = time.Date(2024, 5, 6, 22, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name string
+		req  Request
+		want Decision
+	}{
+		{"own post", Request{Subject: liz, Resource: post, Operation: Update, Environment: office}, Decision{Allowed: true, Rule: "own-posts"}},
+		{"other post", Request{Subject: liz, Resource: Resource{Type: "post", Owner: "tom"}, Operation: Update, Environment: office}, Decision{}},
+		{"read anything", Request{Subject: liz, Resource: Resource{Type: "post", Owner: "tom"}, Operation: Read, Environment: office}, Decision{Allowed: true, Rule: "readers"}},
+		{"delete in the office", Request{Subject: liz, Resource: post, Operation: Delete, Environment: office}, Decision{Allowed: true, Rule: "own-posts"}},
+		// a deny overrides an allow, whatever the order
+		{"delete from home", Request{Subject: liz, Resource: post, Operation: Delete, Environment: home}, Decision{Rule: "outside-office"}},
+		{"update at night", Request{Subject: liz, Resource: post, Operation: Update, Environment: night}, Decision{Rule: "night"}},
+		{"read at night", Request{Subject: liz, Resource: post, Operation: Read, Environment: night}, Decision{Allowed: true, Rule: "own-posts"}},
+		{"delete without an address", Request{Subject: liz, Resource: post, Operation: Delete, Environment: Environment{Time: office.Time}}, Decision{Rule: "outside-office"}},
+	} {
+		if got := e.Evaluate(tc.req); got != tc.want {
+			t.Errorf("%s: Evaluate = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEngineEvaluateError(t *testing.T) {
+	e := newTestEngine(t,
+		ABACRule{Name: "senior", Effect: EffectAllow, Condition: `subject.level > 3`},
+		ABACRule{Name: "everyone", Effect: EffectAllow},
+	)
+	// a condition that cannot be evaluated denies, even in a rule allowing
+	d := e.Evaluate(Request{Subject: Subject{Attributes: map[string]string{"level": "high"}}})
+	if d.Allowed || d.Rule != "senior" || d.Err == nil {
+		t.Errorf("Evaluate = %+v, want a denial by senior with an error", d)
+	}
+	if d := e.Evaluate(Request{Subject: Subject{Attributes: map[string]string{"level": "4"}}}); !d.Allowed || d.Err != nil {
+		t.Errorf("Evaluate = %+v, want allowed", d)
+	}
+}
+
+func TestEngineDeniesByDefault(t *testing.T) {
+	e := newTestEngine(t)
+	if d := e.Evaluate(Request{Operation: Read}); d != (Decision{}) {
+		t.Errorf("Evaluate with no rules = %+v, want a denial by no rule", d)
+	}
+}
+
+func TestEngineNewPermissionCopiesAttributes(t *testing.T) {
+	e := newTestEngine(t, ABACRule{Name: "editors", Effect: EffectAllow, Condition: `subject.team == "news"`})
+	attributes := map[string]string{"team": "news"}
+	perm := e.NewPermission(Subject{ID: "liz", Attributes: attributes}, Environment{})
+	attributes["team"] = "sports"
+	if !perm.IsAllow(Read) {
+		t.Error("changing the attributes after NewPermission changed its decisions")
+	}
+}
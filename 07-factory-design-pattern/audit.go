@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one permission check
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Subject   Subject   `json:"subject"`
+	Operation Operation `json:"operation"`
+	Resource  *Resource `json:"resource,omitempty"` // nil for IsAllow
+	Allowed   bool      `json:"allowed"`
+	Rule      string    `json:"rule,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AuditSink stores audit records. Record is called for every recorded check,
+// possibly from several goroutines.
+type AuditSink interface {
+	Record(r AuditRecord) error
+}
+
+// AuditFunc lets a function be used as an AuditSink
+type AuditFunc func(r AuditRecord) error
+
+func (f AuditFunc) Record(r AuditRecord) error {
+	return f(r)
+}
+
+type AuditConfig struct {
+	Sinks []AuditSink
+
+	// Sample decides which checks are recorded, every one when nil
+	Sample func(r AuditRecord) bool
+	// Redact changes a record before it is stored, to hide personal data
+	// for example. The record is a copy, its attributes can be changed.
+	Redact func(r AuditRecord) AuditRecord
+	// OnError is told about sinks failing to store a record. The failure
+	// never changes the decision.
+	OnError func(err error)
+	Now     func() time.Time // time.Now when nil
+}
+
+// Auditor records the checks of the permissions it wraps
+type Auditor struct {
+	config AuditConfig
+}
+
+func NewAuditor(config AuditConfig) *Auditor {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &Auditor{config: config}
+}
+
+// SubjectPermission is a permission that knows who it was created for, like
+// the permissions of a PermissionFactory or an Engine
+type SubjectPermission interface {
+	Permission
+	Subject() Subject
+}
+
+// Wrap returns a permission that decides like p does and records every
+// decision. The subject is only known when p is a SubjectPermission and the
+// matched rule when p is a Decider.
+func (a *Auditor) Wrap(p Permission) Decider {
+	var subject Subject
+	if sp, ok := p.(SubjectPermission); ok {
+		subject = sp.Subject()
+	}
+	return &auditedPermission{permission: p, subject: subject, auditor: a}
+}
+
+type auditedPermission struct {
+	permission Permission
+	subject    Subject
+	auditor    *Auditor
+}
+
+func (p *auditedPermission) Subject() Subject {
+	s := p.subject
+	s.Attributes = maps.Clone(s.Attributes)
+	return s
+}
+
+func (p *auditedPermission) IsAllow(operation Operation) bool {
+	return p.decide(operation, nil).Allowed
+}
+
+func (p *auditedPermission) IsAllowOn(operation Operation, resource Resource) bool {
+	return p.decide(operation, &resource).Allowed
+}
+
+func (p *auditedPermission) Decide(operation Operation, resource Resource) Decision {
+	return p.decide(operation, &resource)
+}
+
+// decide checks the operation on any resource when resource is nil
+func (p *auditedPermission) decide(operation Operation, resource *Resource) Decision {
+	var d Decision
+	decider, ok := p.permission.(Decider)
+	switch {
+	case ok && resource == nil:
+		d = decider.Decide(operation, Resource{})
+	case ok:
+		d = decider.Decide(operation, *resource)
+	case resource == nil:
+		d.Allowed = p.permission.IsAllow(operation)
+	default:
+		d.Allowed = p.permission.IsAllowOn(operation, *resource)
+	}
+	p.auditor.record(p.subject, operation, resource, d)
+	return d
+}
+
+func (a *Auditor) record(subject Subject, operation Operation, resource *Resource, d Decision) {
+	r := AuditRecord{
+		Time:      a.config.Now(),
+		Subject:   subject,
+		Operation: operation,
+		Allowed:   d.Allowed,
+		Rule:      d.Rule,
+	}
+	if resource != nil {
+		res := *resource
+		r.Resource = &res
+	}
+	if d.Err != nil {
+		r.Error = d.Err.Error()
+	}
+	if a.config.Sample != nil && !a.config.Sample(r) {
+		return
+	}
+	// the attributes belong to the caller
+	r.Subject.Attributes = maps.Clone(r.Subject.Attributes)
+	if r.Resource != nil {
+		r.Resource.Attributes = maps.Clone(r.Resource.Attributes)
+	}
+	if a.config.Redact != nil {
+		r = a.config.Redact(r)
+	}
+	for _, sink := range a.config.Sinks {
+		if err := sink.Record(r); err != nil && a.config.OnError != nil {
+			a.config.OnError(err)
+		}
+	}
+}
+
+// SampleAllowed records a share of the allowed checks, between 0 and 1,
+// and every denied one
+func SampleAllowed(rate float64) func(AuditRecord) bool {
+	return func(r AuditRecord) bool {
+		return !r.Allowed || rand.Float64() < rate
+	}
+}
+
+const redacted = "REDACTED"
+
+// RedactAttributes hides the values of these subject and resource
+// attributes, and the subject ID when "id" is one of them
+func RedactAttributes(names ...string) func(AuditRecord) AuditRecord {
+	return func(r AuditRecord) AuditRecord {
+		for _, name := range names {
+			if _, ok := r.Subject.Attributes[name]; ok {
+				r.Subject.Attributes[name] = redacted
+			}
+			if r.Resource != nil {
+				if _, ok := r.Resource.Attributes[name]; ok {
+					r.Resource.Attributes[name] = redacted
+				}
+			}
+		}
+		if slices.Contains(names, "id") && r.Subject.ID != "" {
+			r.Subject.ID = redacted
+		}
+		return r
+	}
+}
+
+// JSONLinesSink writes every record as a line of JSON
+type JSONLinesSink struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	file *os.File // when opened by OpenJSONLinesSink
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{enc: json.NewEncoder(w)}
+}
+
+// OpenJSONLinesSink appends to a file, created when missing
+func OpenJSONLinesSink(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := NewJSONLinesSink(f)
+	s.file = f
+	return s, nil
+}
+
+func (s *JSONLinesSink) Record(r AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// one write per record, lines of concurrent writers never mix
+	return s.enc.Encode(r)
+}
+
+// Close closes the file opened by OpenJSONLinesSink, and nothing otherwise
+func (s *JSONLinesSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// RingBufferSink keeps the last records in memory
+type RingBufferSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	next    int // where the next record goes once full
+}
+
+func NewRingBufferSink(size int) *RingBufferSink {
+	return &RingBufferSink{records: make([]AuditRecord, 0, max(size, 1))}
+}
+
+func (s *RingBufferSink) Record(r AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) < cap(s.records) {
+		s.records = append(s.records, r)
+		return nil
+	}
+	s.records[s.next] = r
+	s.next = (s.next + 1) % len(s.records)
+	return nil
+}
+
+// Records returns the records kept, oldest first
+func (s *RingBufferSink) Records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(slices.Clone(s.records[s.next:]), s.records[:s.next]...)
+}
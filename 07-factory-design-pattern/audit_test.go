@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestAuditorWrapSubject(t *testing.T) {
+	liz := Subject{ID: "liz", Role: "author", Attributes: map[string]string{"email": "liz@test.com"}}
+	policy, err := LoadPolicy(policyFiles, "policies/blog.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory, err := NewPermissionFactory(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleBased, err := factory.NewPermissionFor(liz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(&ABACPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, perm := range map[string]Permission{
+		"role":   roleBased,
+		"abac":   engine.NewPermission(liz, Environment{}),
+		"nested": NewAuditor(AuditConfig{}).Wrap(roleBased),
+	} {
+		recent := NewRingBufferSink(1)
+		NewAuditor(AuditConfig{Sinks: []AuditSink{recent}}).Wrap(perm).IsAllow(Read)
+		records := recent.Records()
+		if len(records) != 1 {
+			t.Fatalf("%s: %d records, want 1", name, len(records))
+		}
+		if got := records[0].Subject; got.ID != "liz" || got.Attributes["email"] != "liz@test.com" {
+			t.Errorf("%s: recorded subject %+v, want %+v", name, got, liz)
+		}
+	}
+
+	recent := NewRingBufferSink(1)
+	anonymous := struct{ Permission }{roleBased}
+	NewAuditor(AuditConfig{Sinks: []AuditSink{recent}}).Wrap(anonymous).IsAllow(Read)
+	if got := recent.Records()[0].Subject; got.ID != "" {
+		t.Errorf("a permission without a subject recorded %+v", got)
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// Conditions of ABAC rules are small boolean expressions:
+//
+//	resource.owner == subject.id && action in ["update", "delete"]
+//	!ip_in(env.ip, "10.0.0.0/8") || env.time < "08:00"
+//
+// Operands are strings, numbers, true and false, lists in brackets and the
+// attributes of a request:
+//
+//	subject.id, subject.role, subject.<attribute>
+//	resource.type, resource.id, resource.owner, resource.<attribute>
+//	action                      the operation name, "create" for example
+//	env.time, env.weekday       "15:04" and "Monday", local time
+//	env.ip                      the address the request comes from
+//
+// An attribute that is not set is missing: it equals nothing, is not in
+// any list and is neither smaller nor greater than anything. The comparisons
+// ==, !=, <, <=, >, >= and in bind tightest, then !, && and ||. The only
+// function is ip_in(ip, prefix...).
+
+var errCondition = errors.New("invalid condition")
+
+// value is nil for a missing attribute, a string, a float64, a bool or a
+// []value
+type value any
+
+type expr interface {
+	eval(req *Request) (value, error)
+}
+
+type literal struct{ value value }
+
+// attribute is a path like subject.id
+type attribute struct{ root, name string }
+
+type list struct{ items []expr }
+
+type not struct{ x expr }
+
+type binary struct {
+	op   string
+	l, r expr
+}
+
+type call struct {
+	fn   string
+	args []expr
+}
+
+var functions = map[string]int{"ip_in": -2} // negative: at least that many arguments
+
+var subjectFields = []string{"id", "role"}
+var resourceFields = []string{"type", "id", "owner"}
+var envFields = []string{"time", "weekday", "ip"}
+
+type token struct {
+	kind rune // a scanner token, or op for operators
+	text string
+	pos  scanner.Position
+}
+
+const op rune = -100
+
+// parseCondition compiles a condition, reporting the first syntax error
+func parseCondition(src string) (expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	x, err := p.parseOr()
+	if err == nil && p.peek().kind != scanner.EOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func tokenize(src string) ([]token, error) {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(src))
+	s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanStrings
+	var scanErr error
+	s.Error = func(s *scanner.Scanner, msg string) {
+		if scanErr == nil {
+			scanErr = fmt.Errorf("%w: column %d: %s", errCondition, s.Position.Column, msg)
+		}
+	}
+
+	tokens := []token{}
+	for {
+		kind := s.Scan()
+		t := token{kind: kind, text: s.TokenText(), pos: s.Position}
+		switch kind {
+		case '=', '!', '<', '>', '&', '|':
+			// two character operators
+			if next := s.Peek(); next == '=' && strings.ContainsRune("=!<>", kind) || next == kind && strings.ContainsRune("&|", kind) {
+				t.text += string(s.Next())
+			}
+			if t.text == "=" || t.text == "&" || t.text == "|" {
+				return nil, fmt.Errorf("%w: column %d: unknown operator %s", errCondition, t.pos.Column, t.text)
+			}
+			t.kind = op
+		}
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		tokens = append(tokens, t)
+		if kind == scanner.EOF {
+			return tokens, nil
+		}
+	}
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != scanner.EOF {
+		p.next++
+	}
+	return t
+}
+
+// accept takes the next token if it has this text
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); t.kind != scanner.String && t.text == text {
+		p.take()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == scanner.EOF {
+		return fmt.Errorf("%w: unexpected end", errCondition)
+	}
+	return fmt.Errorf("%w: column %d: unexpected %s", errCondition, t.pos.Column, t.text)
+}
+
+func (p *parser) parseOr() (expr, error) {
+	return p.parseBinary([]string{"||"}, p.parseAnd)
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	return p.parseBinary([]string{"&&"}, p.parseNot)
+}
+
+func (p *parser) parseBinary(ops []string, operand func() (expr, error)) (expr, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for slices.Contains(ops, p.peek().text) && p.peek().kind == op {
+		o := p.take().text
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{op: o, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("!") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == op && slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, t.text),
+		t.kind == scanner.Ident && t.text == "in":
+		p.take()
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &binary{op: t.text, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseOperand() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case scanner.String:
+		p.take()
+		s, err := strconv.Unquote(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: column %d: %v", errCondition, t.pos.Column, err)
+		}
+		return &literal{value: s}, nil
+	case scanner.Float, scanner.Int:
+		p.take()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: column %d: %v", errCondition, t.pos.Column, err)
+		}
+		return &literal{value: f}, nil
+	case scanner.Ident:
+		p.take()
+		switch {
+		case t.text == "true" || t.text == "false":
+			return &literal{value: t.text == "true"}, nil
+		case p.peek().text == "(":
+			return p.parseCall(t)
+		}
+		return p.parseAttribute(t)
+	case '[':
+		p.take()
+		l := &list{}
+		for !p.accept("]") {
+			if len(l.items) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			l.items = append(l.items, item)
+		}
+		return l, nil
+	case '(':
+		p.take()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	}
+	return nil, p.unexpected()
+}
+
+func (p *parser) parseCall(name token) (expr, error) {
+	arity, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("%w: column %d: unknown function %s", errCondition, name.pos.Column, name.text)
+	}
+	p.take() // (
+	c := &call{fn: name.text}
+	for !p.accept(")") {
+		if len(c.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	if arity >= 0 && len(c.args) != arity || arity < 0 && len(c.args) < -arity {
+		return nil, fmt.Errorf("%w: column %d: wrong number of arguments to %s", errCondition, name.pos.Column, name.text)
+	}
+	// literal prefixes are checked now rather than on every evaluation
+	for _, arg := range c.args[1:] {
+		if lit, ok := arg.(*literal); ok {
+			s, _ := lit.value.(string)
+			if _, err := netip.ParsePrefix(s); err != nil {
+				return nil, fmt.Errorf("%w: column %d: %v", errCondition, name.pos.Column, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parseAttribute(root token) (expr, error) {
+	if root.text == "action" {
+		return &attribute{root: "action"}, nil
+	}
+	fields := map[string][]string{"subject": subjectFields, "resource": resourceFields, "env": envFields}[root.text]
+	if fields == nil {
+		return nil, fmt.Errorf("%w: column %d: unknown attribute %s", errCondition, root.pos.Column, root.text)
+	}
+	if err := p.expect("."); err != nil {
+		return nil, err
+	}
+	name := p.take()
+	if name.kind != scanner.Ident {
+		return nil, fmt.Errorf("%w: column %d: attribute name expected after %s.", errCondition, name.pos.Column, root.text)
+	}
+	// the environment has no free-form attributes
+	if root.text == "env" && !slices.Contains(fields, name.text) {
+		return nil, fmt.Errorf("%w: column %d: unknown attribute env.%s", errCondition, name.pos.Column, name.text)
+	}
+	return &attribute{root: root.text, name: name.text}, nil
+}
+
+func (x *literal) eval(*Request) (value, error) {
+	return x.value, nil
+}
+
+func (x *attribute) eval(req *Request) (value, error) {
+	str := func(s string) value {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	switch x.root {
+	case "action":
+		return req.Operation.String(), nil
+	case "subject":
+		switch x.name {
+		case "id":
+			return str(req.Subject.ID), nil
+		case "role":
+			return str(req.Subject.Role), nil
+		}
+		return lookup(req.Subject.Attributes, x.name), nil
+	case "resource":
+		switch x.name {
+		case "type":
+			return str(req.Resource.Type), nil
+		case "id":
+			return str(req.Resource.ID), nil
+		case "owner":
+			return str(req.Resource.Owner), nil
+		}
+		return lookup(req.Resource.Attributes, x.name), nil
+	}
+
+	switch x.name {
+	case "time":
+		return req.Environment.Time.Format("15:04"), nil
+	case "weekday":
+		return req.Environment.Time.Weekday().String(), nil
+	}
+	if !req.Environment.IP.IsValid() {
+		return nil, nil
+	}
+	return req.Environment.IP.String(), nil
+}
+
+func lookup(attributes map[string]string, name string) value {
+	if v, ok := attributes[name]; ok {
+		return v
+	}
+	return nil
+}
+
+func (x *list) eval(req *Request) (value, error) {
+	items := []value{}
+	for _, item := range x.items {
+		v, err := item.eval(req)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (x *not) eval(req *Request) (value, error) {
+	b, err := evalBool(x.x, req)
+	return !b, err
+}
+
+func (x *binary) eval(req *Request) (value, error) {
+	switch x.op {
+	case "&&", "||":
+		l, err := evalBool(x.l, req)
+		if err != nil || l == (x.op == "||") {
+			return l, err
+		}
+		return evalBool(x.r, req)
+	}
+
+	l, err := x.l.eval(req)
+	if err != nil {
+		return nil, err
+	}
+	r, err := x.r.eval(req)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		eq, err := equal(l, r)
+		return !eq, err
+	case "in":
+		items, ok := r.([]value)
+		if !ok {
+			return nil, fmt.Errorf("in needs a list, not %v", r)
+		}
+		for _, item := range items {
+			if eq, err := equal(l, item); eq || err != nil {
+				return eq, err
+			}
+		}
+		return false, nil
+	}
+
+	if l == nil || r == nil {
+		return false, nil
+	}
+	c, err := compare(l, r)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func (x *call) eval(req *Request) (value, error) {
+	// ip_in is the only function
+	ip, err := x.args[0].eval(req)
+	if err != nil || ip == nil {
+		return false, err
+	}
+	s, ok := ip.(string)
+	if !ok {
+		return nil, fmt.Errorf("ip_in needs an address, not %v", ip)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range x.args[1:] {
+		v, err := arg.eval(req)
+		if err != nil {
+			return nil, err
+		}
+		s, _ := v.(string)
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		if prefix.Contains(addr.Unmap()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalBool(x expr, req *Request) (bool, error) {
+	v, err := x.eval(req)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok && v == nil {
+		return false, errors.New("a missing attribute is not true or false")
+	}
+	if !ok {
+		return false, fmt.Errorf("%v is not true or false", v)
+	}
+	return b, nil
+}
+
+// equal compares a string and a number as numbers, a missing attribute is
+// equal to nothing
+func equal(l, r value) (bool, error) {
+	if l == nil || r == nil {
+		return false, nil
+	}
+	if _, ok := l.([]value); ok {
+		return false, errors.New("lists cannot be compared")
+	}
+	if _, ok := r.([]value); ok {
+		return false, errors.New("lists cannot be compared")
+	}
+	if lb, ok := l.(bool); ok {
+		rb, ok := r.(bool)
+		return ok && lb == rb, nil
+	}
+	if _, ok := r.(bool); ok {
+		return false, nil
+	}
+	c, err := compare(l, r)
+	return c == 0, err
+}
+
+// compare orders two strings, or two numbers
+func compare(l, r value) (int, error) {
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		return strings.Compare(ls, rs), nil
+	}
+	lf, err := number(l)
+	if err != nil {
+		return 0, err
+	}
+	rf, err := number(r)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case lf < rf:
+		return -1, nil
+	case lf > rf:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func number(v value) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("%v cannot be ordered", v)
+}
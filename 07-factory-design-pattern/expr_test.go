@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseConditionErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"subject.id ==",
+		"subject.id = \"liz\"",
+		"subject.id & true",
+		"(subject.id == \"liz\"",
+		"subject.id == \"liz\")",
+		"subject",
+		"subject.",
+		"user.id == \"liz\"",
+		"env.location == \"office\"",
+		"resource.tags in [\"a\" \"b\"]",
+		"now() == 1",
+		"ip_in(env.ip)",
+		"ip_in(env.ip, \"10.0.0.0/33\")",
+		"ip_in(env.ip, \"office\")",
+		"\"unterminated",
+	} {
+		if _, err := parseCondition(src); !errors.Is(err, errCondition) {
+			t.Errorf("parseCondition(%q) = %v, want %v", src, err, errCondition)
+		}
+	}
+}
+
+// evalCondition parses and evaluates a condition
+func evalCondition(t *testing.T, src string, req Request) (bool, error) {
+	t.Helper()
+	x, err := parseCondition(src)
+	if err != nil {
+		t.Fatalf("parseCondition(%q): %v", src, err)
+	}
+	return evalBool(x, &req)
+}
+
+func TestEvalCondition(t *testing.T) {
+	req := Request{
+		Subject:   Subject{ID: "liz", Role: "author", Attributes: map[string]string{"level": "3", "ip": "not an ip"}},
+		Resource:  Resource{Type: "post", Owner: "liz", Attributes: map[string]string{"category": "news"}},
+		Operation: Update,
+		Environment: Environment{
+			Time: time.Date(2024, 5, 6, 7, 30, 0, 0, time.UTC), // a Monday
+			IP:   netip.MustParseAddr("10.1.2.3"),
+		},
+	}
+	noIP := req
+	noIP.Environment.IP = netip.Addr{}
+
+	for _, tc := range []struct {
+		src  string
+		req  Request
+		want bool
+	}{
+		// precedence: comparisons, then !, && and ||
+		{`!subject.id == "tom"`, req, true},
+		{`!(subject.id == "liz")`, req, false},
+		{`subject.id == "tom" && false || true`, req, true},
+		{`true || subject.id == "tom" && false`, req, true},
+		{`!true || true`, req, true},
+		{`!(true || true)`, req, false},
+
+		{`resource.owner == subject.id && action in ["update", "delete"]`, req, true},
+		{`action == "update"`, req, true},
+		{`subject.level > 2 && subject.level <= 3`, req, true},
+		{`subject.level == 3`, req, true},
+		{`resource.category in ["news", "sports"]`, req, true},
+
+		// a missing attribute equals nothing and is in no list
+		{`subject.team == "blue"`, req, false},
+		{`subject.team != "blue"`, req, true},
+		{`subject.team == subject.group`, req, false},
+		{`subject.team in ["blue", "red"]`, req, false},
+		{`subject.team < "m" || subject.team >= "m"`, req, false},
+		{`resource.id == ""`, req, false},
+
+		{`ip_in(env.ip, "10.0.0.0/8")`, req, true},
+		{`ip_in(env.ip, "192.168.0.0/16", "10.1.0.0/16")`, req, true},
+		{`ip_in(env.ip, "192.168.0.0/16")`, req, false},
+		{`ip_in(env.ip, "10.0.0.0/8")`, noIP, false},
+		{`!ip_in(env.ip, "10.0.0.0/8")`, noIP, true},
+
+		{`env.time < "08:00"`, req, true},
+		{`env.time >= "07:30" && env.time < "07:31"`, req, true},
+		{`env.time >= "21:00"`, req, false},
+		{`env.weekday == "Monday"`, req, true},
+	} {
+		got, err := evalCondition(t, tc.src, tc.req)
+		if err != nil || got != tc.want {
+			t.Errorf("%s = %v, %v, want %v", tc.src, got, err, tc.want)
+		}
+	}
+}
+
+func TestEvalConditionErrors(t *testing.T) {
+	req := Request{
+		Subject:     Subject{ID: "liz", Attributes: map[string]string{"level": "high", "ip": "not an ip"}},
+		Resource:    Resource{Type: "post"},
+		Environment: Environment{IP: netip.MustParseAddr("10.1.2.3")},
+	}
+	for _, src := range []string{
+		`subject.level > 2`,
+		`subject.id`,
+		`subject.team`,
+		`subject.id in "liz"`,
+		`["a"] == ["a"]`,
+		`ip_in(subject.ip, "10.0.0.0/8")`,
+		`ip_in(env.ip, subject.id)`,
+		`ip_in(true, "10.0.0.0/8")`,
+	} {
+		if got, err := evalCondition(t, src, req); err == nil {
+			t.Errorf("%s = %v, want an error", src, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// PermissionFactory creates the permissions of the roles of a policy. The
+// inheritance is resolved once, when the factory is created.
+type PermissionFactory struct {
+	roles map[string]permission
+}
+
+// NewPermissionFactory validates the policy first, an invalid policy never
+// hands out permissions
+func NewPermissionFactory(p *Policy) (*PermissionFactory, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	f := &PermissionFactory{roles: map[string]permission{}}
+	for name := range p.Roles {
+		f.roles[name] = permission{operations: p.operations(name), rules: p.rules(name)}
+	}
+	return f, nil
+}
+
+// NewPermission creates the permission of a role for nobody in particular,
+// rules about ownership or subject attributes never match
+func (f *PermissionFactory) NewPermission(role string) (Permission, error) {
+	return f.NewPermissionFor(Subject{Role: role})
+}
+
+// NewPermissionFor creates the permission of a subject, given by its role
+func (f *PermissionFactory) NewPermissionFor(subject Subject) (Permission, error) {
+	perm, ok := f.roles[subject.Role]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRole, subject.Role)
+	}
+	// a copy, no permission can change another one
+	subject.Attributes = maps.Clone(subject.Attributes)
+	perm.subject = subject
+	return &perm, nil
+}
+
+//go:embed policies
+var policyFiles embed.FS
+
+// defaultFactory backs NewPermission, created from policies/default.json
+var defaultFactory = mustDefaultFactory()
+
+func mustDefaultFactory() *PermissionFactory {
+	p, err := LoadPolicy(policyFiles, "policies/default.json")
+	if err != nil {
+		panic(err)
+	}
+	f, err := NewPermissionFactory(p)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
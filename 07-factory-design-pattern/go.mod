@@ -0,0 +1,3 @@
+module factory
+
+go 1.22.0
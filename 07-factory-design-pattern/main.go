@@ -1,6 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"time"
+)
 
 const (
 	Admin int = iota
@@ -8,67 +15,249 @@ const (
 	Guest
 )
 
-const (
-	Create int = iota
-	Read
-	Update
-	Delete
-)
+// roleNames are the names of the roles in policies/default.json
+var roleNames = map[int]string{
+	Admin: "admin",
+	User:  "user",
+	Guest: "guest",
+}
 
 type Permission interface {
-	IsAllow(operation int) bool
+	// IsAllow reports whether the operation is allowed on any resource
+	IsAllow(operation Operation) bool
+	// IsAllowOn reports whether the operation is allowed on this resource
+	IsAllowOn(operation Operation, resource Resource) bool
+}
+
+// Decision tells which rule decided, Rule is empty when no rule matched and
+// the request is denied by default. A rule of an ABAC policy whose condition
+// cannot be evaluated, comparing a name with a number for example, denies
+// the request whatever its effect and Err says why.
+type Decision struct {
+	Allowed bool
+	Rule    string
+	Err     error
+}
+
+// Decider is a Permission that tells which rule decided. Decide with the
+// zero Resource is what IsAllow answers.
+type Decider interface {
+	Permission
+	Decide(operation Operation, resource Resource) Decision
+}
+
+// Subject is who asks for a permission
+type Subject struct {
+	ID         string            `json:"id,omitempty"`
+	Role       string            `json:"role,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Resource is what an operation is done on, a post for example
+type Resource struct {
+	Type       string            `json:"type,omitempty"`
+	ID         string            `json:"id,omitempty"`
+	Owner      string            `json:"owner,omitempty"` // the ID of the subject owning it
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type permission struct {
-	canCreate, canRead, canUpdate, canDelete bool
+	operations Operations // on any resource
+
+	// for IsAllowOn
+	subject Subject
+	rules   []rule
 }
 
-func (p *permission) IsAllow(operation int) bool {
-	allowed := false
-	switch operation {
-	case Create:
-		allowed = p.canCreate
-	case Read:
-		allowed = p.canRead
-	case Update:
-		allowed = p.canUpdate
-	case Delete:
-		allowed = p.canDelete
-	}
+// Subject is who the permission was created for, a copy
+func (p *permission) Subject() Subject {
+	s := p.subject
+	s.Attributes = maps.Clone(s.Attributes)
+	return s
+}
 
-	return allowed
+func (p *permission) IsAllow(operation Operation) bool {
+	return p.Decide(operation, Resource{}).Allowed
 }
 
-func NewPermission(role int) Permission {
-	// default zero values are false
-	p := permission{}
+func (p *permission) IsAllowOn(operation Operation, resource Resource) bool {
+	return p.Decide(operation, resource).Allowed
+}
 
-	// set it initially as a guest
-	// where the default value for the read permission is always true
-	p.canRead = true
+// Decide names the role when it may do the operation on any resource, and
+// the rule allowing it on this resource otherwise
+func (p *permission) Decide(operation Operation, resource Resource) Decision {
+	if p.operations.Has(operation) {
+		return Decision{Allowed: true, Rule: p.subject.Role}
+	}
+	for _, r := range p.rules {
+		if r.matches(operation, p.subject, resource) {
+			return Decision{Allowed: true, Rule: r.name}
+		}
+	}
+	return Decision{}
+}
 
-	switch role {
-	case Admin:
-		p.canDelete = true
-	case User:
-		p.canCreate = true
-		p.canRead = true
-		p.canUpdate = true
+// NewPermission creates the permission of one of the built-in roles, as
+// defined by policies/default.json. An unknown role is a guest.
+func NewPermission(role int) Permission {
+	name, ok := roleNames[role]
+	if !ok {
+		name = roleNames[Guest]
+	}
+	p, err := defaultFactory.NewPermission(name)
+	if err != nil {
+		// the default policy defines every built-in role
+		panic(err)
 	}
-	return &p
+	return p
 }
 
 func main() {
+	policyFile := flag.String("policy", "", "JSON policy file defining the roles, the built-in roles when empty")
+	flag.Parse()
+
+	factory := defaultFactory
+	if *policyFile != "" {
+		f, err := os.Open(*policyFile)
+		if err != nil {
+			panic(err)
+		}
+		policy, err := ParsePolicy(f)
+		f.Close()
+		if err != nil {
+			panic(err)
+		}
+		if factory, err = NewPermissionFactory(policy); err != nil {
+			panic(err)
+		}
+	}
+
+	newPermission := func(role string) Permission {
+		p, err := factory.NewPermission(role)
+		if err != nil {
+			panic(err)
+		}
+		return p
+	}
+
 	// Bob as an admin
-	bob := NewPermission(Admin)
+	bob := newPermission("admin")
 
 	// Liz as an author
-	liz := NewPermission(User)
+	liz := newPermission("user")
 
 	// Tom as a guest
-	tom := NewPermission(Guest)
+	tom := newPermission("guest")
 
 	fmt.Println("Is Bob allowed to create a post:", bob.IsAllow(Create))
 	fmt.Println("Is Liz allowed to create a post:", liz.IsAllow(Create))
 	fmt.Println("Is Tom allowed to create a post:", tom.IsAllow(Create))
+	fmt.Println("Is Bob allowed to delete a post:", bob.IsAllow(Delete))
+	fmt.Println("Is Liz allowed to delete a post:", liz.IsAllow(Delete))
+
+	blogExample()
+	abacExample()
+	auditExample()
+}
+
+// blogExample checks permissions on posts, with policies/blog.json
+func blogExample() {
+	policy, err := LoadPolicy(policyFiles, "policies/blog.json")
+	if err != nil {
+		panic(err)
+	}
+	factory, err := NewPermissionFactory(policy)
+	if err != nil {
+		panic(err)
+	}
+	newPermission := func(subject Subject) Permission {
+		p, err := factory.NewPermissionFor(subject)
+		if err != nil {
+			panic(err)
+		}
+		return p
+	}
+
+	liz := newPermission(Subject{ID: "liz", Role: "author"})
+	eve := newPermission(Subject{ID: "eve", Role: "editor", Attributes: map[string]string{"desk": "news"}})
+	bob := newPermission(Subject{ID: "bob", Role: "admin"})
+
+	lizPost := Resource{Type: "post", ID: "1", Owner: "liz", Attributes: map[string]string{"category": "news"}}
+	tomPost := Resource{Type: "post", ID: "2", Owner: "tom", Attributes: map[string]string{"category": "sports"}}
+
+	fmt.Println()
+	fmt.Println("Is Liz allowed to update Liz's post:", liz.IsAllowOn(Update, lizPost))
+	fmt.Println("Is Liz allowed to update Tom's post:", liz.IsAllowOn(Update, tomPost))
+	fmt.Println("Is Eve allowed to update a news post:", eve.IsAllowOn(Update, lizPost))
+	fmt.Println("Is Eve allowed to update a sports post:", eve.IsAllowOn(Update, tomPost))
+	fmt.Println("Is Bob allowed to delete Tom's post:", bob.IsAllowOn(Delete, tomPost))
+}
+
+// abacExample checks permissions by attributes, with policies/abac.json
+func abacExample() {
+	f, err := policyFiles.Open("policies/abac.json")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	policy, err := ParseABACPolicy(f)
+	if err != nil {
+		panic(err)
+	}
+	engine, err := NewEngine(policy)
+	if err != nil {
+		panic(err)
+	}
+
+	now := time.Now()
+	noon := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, time.Local)
+	office := Environment{Time: noon, IP: netip.MustParseAddr("10.0.0.7")}
+	home := Environment{Time: noon, IP: netip.MustParseAddr("203.0.113.9")}
+
+	lizAtHome := engine.NewPermission(Subject{ID: "liz"}, home).(Decider)
+	lizAtOffice := engine.NewPermission(Subject{ID: "liz"}, office).(Decider)
+	post := Resource{Type: "post", ID: "1", Owner: "liz", Attributes: map[string]string{"status": "draft"}}
+
+	fmt.Println()
+	for _, check := range []struct {
+		question string
+		decision Decision
+	}{
+		{"Is Liz allowed to update Liz's post from home", lizAtHome.Decide(Update, post)},
+		{"Is Liz allowed to delete Liz's post from home", lizAtHome.Decide(Delete, post)},
+		{"Is Liz allowed to delete Liz's post from the office", lizAtOffice.Decide(Delete, post)},
+	} {
+		fmt.Printf("%s: %v (%s)\n", check.question, check.decision.Allowed, check.decision.Rule)
+	}
+}
+
+// auditExample records the checks of a permission as JSON lines
+func auditExample() {
+	recent := NewRingBufferSink(100)
+	auditor := NewAuditor(AuditConfig{
+		Sinks:  []AuditSink{NewJSONLinesSink(os.Stdout), recent},
+		Redact: RedactAttributes("email"),
+	})
+
+	liz := Subject{ID: "liz", Role: "author", Attributes: map[string]string{"email": "liz@test.com"}}
+	policy, err := LoadPolicy(policyFiles, "policies/blog.json")
+	if err != nil {
+		panic(err)
+	}
+	factory, err := NewPermissionFactory(policy)
+	if err != nil {
+		panic(err)
+	}
+	perm, err := factory.NewPermissionFor(liz)
+	if err != nil {
+		panic(err)
+	}
+	audited := auditor.Wrap(perm)
+
+	fmt.Println()
+	audited.IsAllow(Create)
+	audited.IsAllowOn(Delete, Resource{Type: "post", ID: "1", Owner: "liz"})
+	audited.IsAllowOn(Delete, Resource{Type: "post", ID: "2", Owner: "tom"})
+	fmt.Println("Checks recorded:", len(recent.Records()))
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operation is what a subject does on a resource
+type Operation uint8
+
+const (
+	Create Operation = iota
+	Read
+	Update
+	Delete
+)
+
+// operationNames are the names policies use for the operations, up to
+// maxOperations of them
+var operationNames = []string{
+	Create: "create",
+	Read:   "read",
+	Update: "update",
+	Delete: "delete",
+}
+
+// maxOperations is the number of bits of Operations
+const maxOperations = 64
+
+func ParseOperation(name string) (Operation, error) {
+	i := slices.Index(operationNames, name)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown operation %q", name)
+	}
+	return Operation(i), nil
+}
+
+func (op Operation) String() string {
+	if int(op) < len(operationNames) {
+		return operationNames[op]
+	}
+	return "Operation(" + strconv.Itoa(int(op)) + ")"
+}
+
+// MarshalText writes the name of the operation, in JSON for example
+func (op Operation) MarshalText() ([]byte, error) {
+	if int(op) >= len(operationNames) {
+		return nil, fmt.Errorf("unknown operation %d", op)
+	}
+	return []byte(op.String()), nil
+}
+
+func (op *Operation) UnmarshalText(text []byte) error {
+	parsed, err := ParseOperation(string(text))
+	if err != nil {
+		return err
+	}
+	*op = parsed
+	return nil
+}
+
+// Operations is a set of operations, a bit for every one. The zero value is
+// the empty set.
+type Operations uint64
+
+// NewOperations panics on an operation that does not fit in the set, it
+// would be silently dropped otherwise
+func NewOperations(ops ...Operation) Operations {
+	var s Operations
+	for _, op := range ops {
+		if op >= maxOperations {
+			panic(fmt.Sprintf("operation %d does not fit in Operations", op))
+		}
+		s |= 1 << op
+	}
+	return s
+}
+
+// AllOperations is the set of every known operation
+func AllOperations() Operations {
+	return 1<<len(operationNames) - 1
+}
+
+// ParseOperations parses a comma separated list of operation names like
+// "create,read", the empty string is the empty set
+func ParseOperations(s string) (Operations, error) {
+	var set Operations
+	if strings.TrimSpace(s) == "" {
+		return set, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		op, err := ParseOperation(strings.TrimSpace(name))
+		if err != nil {
+			return 0, err
+		}
+		set |= NewOperations(op)
+	}
+	return set, nil
+}
+
+func (s Operations) Has(op Operation) bool {
+	return op < maxOperations && s&(1<<op) != 0
+}
+
+func (s Operations) Union(other Operations) Operations {
+	return s | other
+}
+
+func (s Operations) Intersect(other Operations) Operations {
+	return s & other
+}
+
+// Difference is the operations of s not in other
+func (s Operations) Difference(other Operations) Operations {
+	return s &^ other
+}
+
+func (s Operations) Len() int {
+	return bits.OnesCount64(uint64(s))
+}
+
+// List returns the operations in order
+func (s Operations) List() []Operation {
+	ops := []Operation{}
+	for rest := uint64(s); rest != 0; rest &= rest - 1 {
+		ops = append(ops, Operation(bits.TrailingZeros64(rest)))
+	}
+	return ops
+}
+
+// String is the form ParseOperations reads, "create,read"
+func (s Operations) String() string {
+	names := []string{}
+	for _, op := range s.List() {
+		names = append(names, op.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// MarshalJSON writes a list of names like policies do, ["create","read"]
+func (s Operations) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.List())
+}
+
+// UnmarshalJSON reads a list of names, or a string ParseOperations accepts
+func (s *Operations) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parsed, err := ParseOperations(text)
+		if err != nil {
+			return err
+		}
+		*s = parsed
+		return nil
+	}
+
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return err
+	}
+	*s = NewOperations(ops...)
+	return nil
+}
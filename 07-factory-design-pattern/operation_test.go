@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestParseOperation(t *testing.T) {
+	for _, op := range []Operation{Create, Read, Update, Delete} {
+		parsed, err := ParseOperation(op.String())
+		if err != nil || parsed != op {
+			t.Errorf("ParseOperation(%q) = %v, %v, want %v", op.String(), parsed, err, op)
+		}
+	}
+	for _, name := range []string{"", "Read", "publish", " read"} {
+		if _, err := ParseOperation(name); err == nil {
+			t.Errorf("ParseOperation(%q) succeeded", name)
+		}
+	}
+	if got := Operation(9).String(); got != "Operation(9)" {
+		t.Errorf("Operation(9).String() = %q, want Operation(9)", got)
+	}
+}
+
+func TestOperationJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]Operation{"op": Update})
+	if err != nil || string(data) != `{"op":"update"}` {
+		t.Errorf("Marshal(Update) = %s, %v", data, err)
+	}
+	var op Operation
+	if err := json.Unmarshal([]byte(`"delete"`), &op); err != nil || op != Delete {
+		t.Errorf("Unmarshal(delete) = %v, %v, want %v", op, err, Delete)
+	}
+	if err := json.Unmarshal([]byte(`"publish"`), &op); err == nil {
+		t.Error("Unmarshal(publish) succeeded")
+	}
+	if _, err := json.Marshal(Operation(9)); err == nil {
+		t.Error("Marshal(Operation(9)) succeeded")
+	}
+}
+
+func TestOperations(t *testing.T) {
+	s := NewOperations(Read, Create, Read)
+	if s.Len() != 2 || !s.Has(Create) || !s.Has(Read) || s.Has(Update) {
+		t.Errorf("NewOperations(read, create, read) = %s", s)
+	}
+	if got := s.List(); !slices.Equal(got, []Operation{Create, Read}) {
+		t.Errorf("List() = %v, want [create read]", got)
+	}
+	other := NewOperations(Read, Delete)
+	for name, tc := range map[string]struct{ got, want Operations }{
+		"union":      {s.Union(other), NewOperations(Create, Read, Delete)},
+		"intersect":  {s.Intersect(other), NewOperations(Read)},
+		"difference": {s.Difference(other), NewOperations(Create)},
+		"all":        {AllOperations(), NewOperations(Create, Read, Update, Delete)},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %s, want %s", name, tc.got, tc.want)
+		}
+	}
+	if Operations(0).Has(Operation(200)) {
+		t.Error("the empty set has Operation(200)")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewOperations(Operation(64)) did not panic")
+		}
+	}()
+	NewOperations(Operation(maxOperations))
+}
+
+func TestParseOperations(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want Operations
+	}{
+		{"", 0},
+		{" ", 0},
+		{"read", NewOperations(Read)},
+		{"create, read ,delete", NewOperations(Create, Read, Delete)},
+	} {
+		got, err := ParseOperations(tc.s)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseOperations(%q) = %s, %v, want %s", tc.s, got, err, tc.want)
+		}
+		// String is what ParseOperations reads
+		if again, err := ParseOperations(got.String()); err != nil || again != got {
+			t.Errorf("ParseOperations(%q) = %s, %v, want %s", got.String(), again, err, got)
+		}
+	}
+	for _, s := range []string{"read,", "read,publish", ",read"} {
+		if _, err := ParseOperations(s); err == nil {
+			t.Errorf("ParseOperations(%q) succeeded", s)
+		}
+	}
+}
+
+func TestOperationsJSON(t *testing.T) {
+	for _, s := range []Operations{0, NewOperations(Update), AllOperations()} {
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Operations
+		if err := json.Unmarshal(data, &got); err != nil || got != s {
+			t.Errorf("Unmarshal(%s) = %s, %v, want %s", data, got, err, s)
+		}
+	}
+	if data, _ := json.Marshal(NewOperations(Delete, Create)); string(data) != `["create","delete"]` {
+		t.Errorf("Marshal(create,delete) = %s, want a list of names", data)
+	}
+
+	for data, want := range map[string]Operations{
+		`"create,read"`:     NewOperations(Create, Read),
+		`""`:                0,
+		`["read","update"]`: NewOperations(Read, Update),
+		`[]`:                0,
+	} {
+		var got Operations
+		if err := json.Unmarshal([]byte(data), &got); err != nil || got != want {
+			t.Errorf("Unmarshal(%s) = %s, %v, want %s", data, got, err, want)
+		}
+	}
+	for _, data := range []string{`"read,publish"`, `["publish"]`, `3`, `[1]`} {
+		var got Operations
+		if err := json.Unmarshal([]byte(data), &got); err == nil {
+			t.Errorf("Unmarshal(%s) = %s, want an error", data, got)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Policy defines what every role may do. A role inherits everything its
+// parent roles may do and adds operations of its own:
+//
+//	{
+//		"roles": {
+//			"guest": {"allow": ["read"]},
+//			"user":  {"inherits": ["guest"], "allow": ["create", "update"]},
+//			"admin": {"inherits": ["user"], "allow": ["delete"]}
+//		}
+//	}
+type Policy struct {
+	Roles map[string]RoleDefinition `json:"roles"`
+}
+
+type RoleDefinition struct {
+	Inherits []string `json:"inherits,omitempty"`
+	Allow    []string `json:"allow,omitempty"` // operation names, on any resource
+	Rules    []Rule   `json:"rules,omitempty"`
+}
+
+// Rule allows operations on the resources matching all of its conditions:
+//
+//	{"allow": ["update", "delete"], "resource": "post", "owner": true}
+//	{"allow": ["update"], "resource": "post", "where": {"category": "news"}}
+//	{"allow": ["update"], "resource": "post", "where": {"category": "$subject.desk"}}
+//
+// A "$subject.name" value in where is the attribute of the subject asking,
+// a rule referring to an attribute the subject does not have never matches.
+type Rule struct {
+	Allow    []string          `json:"allow"`
+	Resource string            `json:"resource,omitempty"` // a resource type, any when empty
+	Owner    bool              `json:"owner,omitempty"`    // only the resources the subject owns
+	Where    map[string]string `json:"where,omitempty"`    // attributes of the resource
+}
+
+const subjectPrefix = "$subject."
+
+// ParsePolicy reads a JSON policy, rejecting unknown fields so a typo does
+// not silently grant or drop an operation. It does not validate the roles,
+// NewPermissionFactory does.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	p := &Policy{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return p, nil
+}
+
+func LoadPolicy(fsys fs.FS, name string) (*Policy, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := ParsePolicy(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
+
+// Validate reports every unknown operation, unknown parent role and
+// inheritance cycle at once
+func (p *Policy) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidPolicy}, args...)...))
+	}
+
+	if len(p.Roles) == 0 {
+		fail("no roles")
+	}
+	for _, name := range p.roleNames() {
+		role := p.Roles[name]
+		if strings.TrimSpace(name) == "" {
+			fail("empty role name")
+		}
+		for _, op := range role.Allow {
+			if _, err := ParseOperation(op); err != nil {
+				fail("role %q: %v", name, err)
+			}
+		}
+		for i, rule := range role.Rules {
+			if len(rule.Allow) == 0 {
+				fail("role %q: rule %d allows nothing", name, i+1)
+			}
+			for _, op := range rule.Allow {
+				if _, err := ParseOperation(op); err != nil {
+					fail("role %q: rule %d: %v", name, i+1, err)
+				}
+			}
+			for attr, value := range rule.Where {
+				if attr == "" || value == subjectPrefix {
+					fail("role %q: rule %d: empty attribute name", name, i+1)
+				}
+			}
+		}
+		for _, parent := range role.Inherits {
+			if _, ok := p.Roles[parent]; !ok {
+				fail("role %q inherits unknown role %q", name, parent)
+			}
+		}
+	}
+
+	// a cycle is reported once, from the first of its roles in name order
+	reported := map[string]bool{}
+	for _, name := range p.roleNames() {
+		if cycle := p.cycle(name, nil); cycle != nil && !reported[cycle[0]] {
+			for _, role := range cycle {
+				reported[role] = true
+			}
+			fail("inheritance cycle %s", strings.Join(append(cycle, cycle[0]), " -> "))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cycle returns the roles of a cycle reachable from name, if any
+func (p *Policy) cycle(name string, path []string) []string {
+	if i := slices.Index(path, name); i >= 0 {
+		return path[i:]
+	}
+	path = append(path, name)
+	for _, parent := range p.Roles[name].Inherits {
+		if cycle := p.cycle(parent, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// operations returns the operations of a role and of every role it
+// inherits from. The policy must be valid.
+func (p *Policy) operations(name string) Operations {
+	var ops Operations
+	for _, parent := range p.Roles[name].Inherits {
+		ops = ops.Union(p.operations(parent))
+	}
+	for _, op := range p.Roles[name].Allow {
+		operation, _ := ParseOperation(op)
+		ops = ops.Union(NewOperations(operation))
+	}
+	return ops
+}
+
+// rules returns the rules of a role and of every role it inherits from.
+// The policy must be valid.
+func (p *Policy) rules(name string) []rule {
+	rules := []rule{}
+	for _, parent := range p.Roles[name].Inherits {
+		rules = append(rules, p.rules(parent)...)
+	}
+	for i, r := range p.Roles[name].Rules {
+		compiled := rule{
+			name:     fmt.Sprintf("%s rule %d", name, i+1),
+			resource: r.Resource,
+			owner:    r.Owner,
+			where:    maps.Clone(r.Where),
+		}
+		for _, op := range r.Allow {
+			operation, _ := ParseOperation(op)
+			compiled.operations = compiled.operations.Union(NewOperations(operation))
+		}
+		rules = append(rules, compiled)
+	}
+	return rules
+}
+
+// rule is a validated Rule
+type rule struct {
+	name       string // the role defining it and its position there
+	operations Operations
+	resource   string
+	owner      bool
+	where      map[string]string
+}
+
+func (r *rule) matches(operation Operation, subject Subject, resource Resource) bool {
+	if !r.operations.Has(operation) {
+		return false
+	}
+	if r.resource != "" && r.resource != resource.Type {
+		return false
+	}
+	if r.owner && (subject.ID == "" || subject.ID != resource.Owner) {
+		return false
+	}
+	for attr, want := range r.where {
+		if name, ok := strings.CutPrefix(want, subjectPrefix); ok {
+			if want, ok = subject.Attributes[name]; !ok {
+				return false
+			}
+		}
+		if got, ok := resource.Attributes[attr]; !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) roleNames() []string {
+	names := make([]string, 0, len(p.Roles))
+	for name := range p.Roles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
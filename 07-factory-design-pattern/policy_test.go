@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestFactory(t *testing.T, name string) *PermissionFactory {
+	t.Helper()
+	p, err := LoadPolicy(policyFiles, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewPermissionFactory(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, data := range []string{
+		`{"roles": {"guest": {"alow": ["read"]}}}`,
+		`{"roles": {"guest": {"allow": "read"}}}`,
+		`{"roles": `,
+	} {
+		if _, err := ParsePolicy(strings.NewReader(data)); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("ParsePolicy(%s) = %v, want %v", data, err, ErrInvalidPolicy)
+		}
+	}
+	if _, err := LoadPolicy(policyFiles, "policies/missing.json"); err == nil {
+		t.Error("LoadPolicy of a missing file succeeded")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, name := range []string{"policies/default.json", "policies/blog.json"} {
+		p, err := LoadPolicy(policyFiles, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if err := (&Policy{}).Validate(); !errors.Is(err, ErrInvalidPolicy) || !strings.Contains(err.Error(), "no roles") {
+		t.Errorf("Validate of no roles = %v, want %v", err, ErrInvalidPolicy)
+	}
+
+	p := &Policy{Roles: map[string]RoleDefinition{
+		" ":      {Allow: []string{"read"}},
+		"guest":  {Allow: []string{"read", "publish"}},
+		"user":   {Inherits: []string{"guest", "nobody"}},
+		"a":      {Inherits: []string{"b"}},
+		"b":      {Inherits: []string{"c"}},
+		"c":      {Inherits: []string{"a"}},
+		"self":   {Inherits: []string{"self"}},
+		"child":  {Inherits: []string{"a"}},
+		"editor": {Rules: []Rule{{Resource: "post"}, {Allow: []string{"archive"}}, {Allow: []string{"update"}, Where: map[string]string{"": "news", "desk": "$subject."}}}},
+	}}
+	err := p.Validate()
+	if !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("Validate = %v, want %v", err, ErrInvalidPolicy)
+	}
+	// every problem is reported, every cycle once
+	for _, want := range []string{
+		"empty role name",
+		`role "guest": unknown operation "publish"`,
+		`role "user" inherits unknown role "nobody"`,
+		"inheritance cycle a -> b -> c -> a",
+		"inheritance cycle self -> self",
+		`role "editor": rule 1 allows nothing`,
+		`role "editor": rule 2: unknown operation "archive"`,
+		`role "editor": rule 3: empty attribute name`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate does not say %s:\n%v", want, err)
+		}
+	}
+	if n := strings.Count(err.Error(), "inheritance cycle"); n != 2 {
+		t.Errorf("Validate reported %d cycles, want 2:\n%v", n, err)
+	}
+
+	if _, err := NewPermissionFactory(p); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("NewPermissionFactory of an invalid policy = %v, want %v", err, ErrInvalidPolicy)
+	}
+}
+
+func TestRoleInheritance(t *testing.T) {
+	f := newTestFactory(t, "policies/default.json")
+	for role, want := range map[string]string{
+		"guest": "read",
+		"user":  "create,read,update",
+		"admin": "create,read,update,delete",
+	} {
+		perm, err := f.NewPermission(role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Operations
+		for _, op := range AllOperations().List() {
+			if perm.IsAllow(op) {
+				got = got.Union(NewOperations(op))
+			}
+		}
+		if got.String() != want {
+			t.Errorf("%s may %s, want %s", role, got, want)
+		}
+	}
+	if _, err := f.NewPermission("root"); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("NewPermission(root) = %v, want %v", err, ErrUnknownRole)
+	}
+
+	// a role inherited along two paths
+	p := &Policy{Roles: map[string]RoleDefinition{
+		"reader":  {Allow: []string{"read"}},
+		"writer":  {Inherits: []string{"reader"}, Allow: []string{"create"}},
+		"cleaner": {Inherits: []string{"reader"}, Allow: []string{"delete"}},
+		"owner":   {Inherits: []string{"writer", "cleaner"}},
+	}}
+	f, err := NewPermissionFactory(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm, _ := f.NewPermission("owner")
+	for op, want := range map[Operation]bool{Create: true, Read: true, Update: false, Delete: true} {
+		if got := perm.IsAllow(op); got != want {
+			t.Errorf("owner IsAllow(%s) = %v, want %v", op, got, want)
+		}
+	}
+}
+
+func TestResourceRules(t *testing.T) {
+	f := newTestFactory(t, "policies/blog.json")
+	subject := func(id, role string, attributes map[string]string) Subject {
+		return Subject{ID: id, Role: role, Attributes: attributes}
+	}
+	ownPost := Resource{Type: "post", ID: "1", Owner: "ann", Attributes: map[string]string{"category": "news"}}
+	otherPost := Resource{Type: "post", ID: "2", Owner: "bob", Attributes: map[string]string{"category": "sports"}}
+	ownComment := Resource{Type: "comment", ID: "3", Owner: "ann", Attributes: map[string]string{"category": "news"}}
+
+	for _, tc := range []struct {
+		subject   Subject
+		operation Operation
+		resource  Resource
+		rule      string // empty when denied
+	}{
+		{subject("ann", "guest", nil), Read, otherPost, "guest"},
+		{subject("ann", "guest", nil), Update, ownPost, ""},
+		// ownership
+		{subject("ann", "author", nil), Update, ownPost, "author rule 1"},
+		{subject("ann", "author", nil), Delete, ownPost, "author rule 1"},
+		{subject("ann", "author", nil), Update, otherPost, ""},
+		{subject("ann", "author", nil), Update, ownComment, ""},
+		{subject("", "author", nil), Update, Resource{Type: "post"}, ""},
+		// where, against an attribute of the subject
+		{subject("cat", "editor", map[string]string{"desk": "sports"}), Update, otherPost, "editor rule 1"},
+		{subject("cat", "editor", map[string]string{"desk": "sports"}), Update, ownPost, ""},
+		{subject("cat", "editor", map[string]string{"desk": "sports"}), Delete, otherPost, ""},
+		{subject("cat", "editor", nil), Update, otherPost, ""},
+		{subject("cat", "editor", map[string]string{"desk": "sports"}), Update, Resource{Type: "post"}, ""},
+		// inherited rules
+		{subject("ann", "editor", map[string]string{"desk": "sports"}), Delete, ownPost, "author rule 1"},
+		{subject("dan", "admin", nil), Delete, otherPost, "admin"},
+	} {
+		perm, err := f.NewPermissionFor(tc.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := perm.(Decider).Decide(tc.operation, tc.resource)
+		if d.Allowed != (tc.rule != "") || d.Rule != tc.rule {
+			t.Errorf("%+v %s %+v = %+v, want rule %q", tc.subject, tc.operation, tc.resource, d, tc.rule)
+		}
+		if got := perm.IsAllowOn(tc.operation, tc.resource); got != d.Allowed {
+			t.Errorf("%+v IsAllowOn(%s, %+v) = %v, Decide says %v", tc.subject, tc.operation, tc.resource, got, d.Allowed)
+		}
+	}
+
+	// without a subject, ownership rules never match
+	perm, err := f.NewPermission("author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm.IsAllowOn(Update, Resource{Type: "post"}) {
+		t.Error("a permission for nobody may update a post owned by nobody")
+	}
+
+	// the subject is copied
+	attributes := map[string]string{"desk": "sports"}
+	perm, _ = f.NewPermissionFor(subject("cat", "editor", attributes))
+	attributes["desk"] = "news"
+	if perm.IsAllowOn(Update, ownPost) || !perm.IsAllowOn(Update, otherPost) {
+		t.Error("changing the attributes after NewPermissionFor changed the permission")
+	}
+}